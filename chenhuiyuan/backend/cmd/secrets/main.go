@@ -0,0 +1,126 @@
+// 管理加密密钥文件：
+//
+//	secrets keygen                       生成随机主密钥
+//	secrets list   [-file F]             列出密钥名
+//	secrets set    [-file F] NAME        从标准输入读取密钥值并写入（新增或轮换）
+//	secrets delete [-file F] NAME        删除密钥
+//
+// 主密钥从环境变量SECRETS_MASTER_KEY读取。运行中的服务会检测到文件变化并重新加载
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"ai-writing-assistant/internal/pkg/secrets"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	file := fs.String("file", "configs/secrets.enc", "加密密钥文件路径")
+	fs.Parse(os.Args[2:])
+
+	var err error
+	switch cmd {
+	case "keygen":
+		err = keygen()
+	case "list":
+		err = list(*file)
+	case "set":
+		err = set(*file, fs.Arg(0))
+	case "delete":
+		err = remove(*file, fs.Arg(0))
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法: secrets keygen | list [-file F] | set [-file F] NAME | delete [-file F] NAME")
+	os.Exit(2)
+}
+
+func keygen() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
+
+// 读取现有密钥，文件不存在时返回空表
+func load(file string) (map[string]string, error) {
+	values, err := secrets.ReadFile(file, os.Getenv(secrets.MasterKeyEnv))
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]string), nil
+	}
+	return values, err
+}
+
+func list(file string) error {
+	values, err := load(file)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func set(file, name string) error {
+	if !secrets.ValidName(name) {
+		return fmt.Errorf("无效的密钥名: %q", name)
+	}
+	values, err := load(file)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return errors.New("密钥值不能为空")
+	}
+	values[name] = value
+	if err := secrets.WriteFile(file, values, os.Getenv(secrets.MasterKeyEnv)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已写入密钥 %s\n", name)
+	return nil
+}
+
+func remove(file, name string) error {
+	values, err := load(file)
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; !ok {
+		return fmt.Errorf("密钥不存在: %s", name)
+	}
+	delete(values, name)
+	if err := secrets.WriteFile(file, values, os.Getenv(secrets.MasterKeyEnv)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已删除密钥 %s\n", name)
+	return nil
+}
@@ -1,11 +1,88 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
 	"ai-writing-assistant/internal/handler"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/config"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/secrets"
 	"ai-writing-assistant/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	r := handler.NewRouter()
-	utils.MustStartServer(r)
+	configPath := flag.String("config", "", "配置文件路径，默认查找configs/config.yaml")
+	printConfig := flag.Bool("print-config", false, "输出生效的配置（密钥脱敏）后退出")
+	flag.Parse()
+
+	// 日志中出现的密钥值一律替换为[secret:名称]；加载配置前的日志写到标准错误
+	log.SetOutput(secrets.NewWriter(os.Stderr))
+	gin.DefaultWriter = secrets.NewWriter(os.Stdout)
+	gin.DefaultErrorWriter = secrets.NewWriter(os.Stderr)
+
+	// 运行环境由APP_ENV指定（如dev、prod），会叠加同目录下的config.<env>.yaml
+	manager, err := ai.InitConfig(config.Options{Path: *configPath, Profile: os.Getenv("APP_ENV")})
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	if *printConfig {
+		if err := config.Print(os.Stdout, manager.Current()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logCfg := manager.Current().Logging
+	closer, err := logging.Setup(logging.Options{
+		Level:      logCfg.Level,
+		Format:     logCfg.Format,
+		Output:     logCfg.Output,
+		MaxSizeMB:  logCfg.Rotation.MaxSizeMB,
+		MaxBackups: logCfg.Rotation.MaxBackups,
+		MaxAge:     logCfg.Rotation.MaxAge,
+	})
+	if err != nil {
+		log.Fatalf("初始化日志失败: %v", err)
+	}
+	defer closer.Close()
+	// 日志级别随配置重新加载生效，输出位置和格式需要重启
+	manager.OnChange(func(old, cfg *ai.AIConfig) {
+		if old.Logging.Level != cfg.Logging.Level {
+			logging.SetLevel(cfg.Logging.Level)
+			slog.Info("日志级别已修改", "level", cfg.Logging.Level)
+		}
+	})
+
+	// 收到SIGINT或SIGTERM时停止接收新请求，等待进行中的请求和异步任务完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := manager.Current().Server
+	r, shutdown := handler.NewRouter()
+	err = utils.RunServer(ctx, r, utils.ServerOptions{
+		Addr:              net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		CertFile:          cfg.TLS.CertFile,
+		KeyFile:           cfg.TLS.KeyFile,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ShutdownTimeout:   cfg.ShutdownTimeout,
+		// 异步任务与进行中的请求共用shutdown_timeout，总停止时间不超过该时限
+		OnShutdown: shutdown,
+	})
+	if err != nil {
+		logging.Fatal("服务运行失败", logging.Err(err))
+	}
 }
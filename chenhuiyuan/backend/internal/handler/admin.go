@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/moderation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 串行化修改角色和删除用户，保证始终至少保留一个管理员
+var adminMu sync.Mutex
+
+var errLastAdmin = errors.New("至少需要保留一个管理员")
+
+func registerAdminRoutes(g *gin.RouterGroup, users account.UserStore, data *userData, svc *ai.Service, manager *ai.ConfigManager, audit *moderation.AuditLog) {
+	// 设置全局默认模型，对所有未指定模型的请求生效
+	g.PUT("/default-model", func(c *gin.Context) {
+		var req switchModelRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+
+		// 检查模型是否可用
+		var targetModel *ai.ModelInfo
+		for _, model := range svc.GetAvailableModels() {
+			if model.Name == req.ModelName {
+				targetModel = &model
+				break
+			}
+		}
+		if targetModel == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "模型不存在"})
+			return
+		}
+		if !targetModel.IsAvailable {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "模型不可用", "health": targetModel.Health})
+			return
+		}
+
+		svc.Use(targetModel.Provider)
+		c.JSON(http.StatusOK, switchModelResponse{
+			Success:   true,
+			Message:   "模型切换成功",
+			ModelName: req.ModelName,
+		})
+	})
+
+	// 重新加载配置文件并重建发生变化的模型提供者
+	g.POST("/providers/reload", func(c *gin.Context) {
+		if err := manager.Reload(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "配置已重新加载", "models": svc.GetAvailableModels(), "current": svc.GetCurrentModel()})
+	})
+
+	// 全部用户的敏感内容命中记录，可按用户名筛选
+	g.GET("/moderation/audit", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		c.JSON(http.StatusOK, audit.Entries(c.Query("user"), limit))
+	})
+
+	// 用户列表
+	g.GET("/users", func(c *gin.Context) {
+		list, err := users.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取用户失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	// 修改用户角色
+	g.PUT("/users/:id/role", func(c *gin.Context) {
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := c.BindJSON(&req); err != nil || !account.ValidRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "角色必须是admin、editor或viewer"})
+			return
+		}
+
+		adminMu.Lock()
+		defer adminMu.Unlock()
+		u, ok := adminTargetUser(c, users)
+		if !ok {
+			return
+		}
+		if u.Role == account.RoleAdmin && req.Role != account.RoleAdmin {
+			if err := ensureOtherAdmin(c.Request.Context(), users, u.ID); err != nil {
+				writeAdminError(c, err)
+				return
+			}
+		}
+		u.Role = req.Role
+		if err := users.Update(c.Request.Context(), u); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		c.JSON(http.StatusOK, u)
+	})
+
+	// 当前因登录失败被锁定的账号和IP
+	g.GET("/lockouts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, activeLockouts())
+	})
+
+	// 解除账号的登录锁定并清空失败次数
+	g.POST("/users/:id/unlock", func(c *gin.Context) {
+		u, ok := adminTargetUser(c, users)
+		if !ok {
+			return
+		}
+		unlockAccount(c.Request.Context(), u.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+	})
+
+	// 删除用户及其全部数据，该用户的全部令牌失效
+	g.DELETE("/users/:id", func(c *gin.Context) {
+		adminMu.Lock()
+		defer adminMu.Unlock()
+		u, ok := adminTargetUser(c, users)
+		if !ok {
+			return
+		}
+		if u.Role == account.RoleAdmin {
+			if err := ensureOtherAdmin(c.Request.Context(), users, u.ID); err != nil {
+				writeAdminError(c, err)
+				return
+			}
+		}
+		if err := users.Delete(c.Request.Context(), u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		data.purge(c.Request.Context(), users, u.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "用户已删除"})
+	})
+}
+
+// 还没有管理员时按auth.initial_admin创建第一个管理员。自助注册只创建编辑者，
+// 新部署上不会因为抢先注册而被他人取得管理员权限
+func ensureInitialAdmin(ctx context.Context, users account.UserStore, cfg ai.InitialAdminConfig) error {
+	list, err := users.List(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(list, func(u *account.User) bool { return u.Role == account.RoleAdmin }) {
+		return nil
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		slog.Warn("还没有管理员账号，请配置auth.initial_admin（或ADMIN_USERNAME和ADMIN_PASSWORD）后重启")
+		return nil
+	}
+	if err := account.CheckPassword(currentPasswordPolicy(), cfg.Username, cfg.Password); err != nil {
+		return fmt.Errorf("auth.initial_admin.password不符合密码要求: %w", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(cfg.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u := &account.User{ID: uuid.NewString(), Username: cfg.Username, PasswordHash: string(hash), Role: account.RoleAdmin}
+	if err := users.Create(ctx, u); err != nil {
+		// 不提升已有的同名用户，否则抢先注册该用户名即可成为管理员
+		if errors.Is(err, account.ErrUsernameTaken) {
+			return fmt.Errorf("auth.initial_admin.username已被其他用户占用或属于已删除的用户: %s", cfg.Username)
+		}
+		return err
+	}
+	securityLog(ctx, slog.LevelInfo, "已创建初始管理员", "user", u.Username)
+	return nil
+}
+
+// 读取路径参数指定的用户，失败时已写入响应
+func adminTargetUser(c *gin.Context, users account.UserStore) (*account.User, bool) {
+	u, err := users.GetByID(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, account.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取用户失败"})
+		return nil, false
+	}
+	return u, true
+}
+
+// 除id之外是否还有其他管理员，调用方需持有adminMu
+func ensureOtherAdmin(ctx context.Context, users account.UserStore, id string) error {
+	list, err := users.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, u := range list {
+		if u.Role == account.RoleAdmin && u.ID != id {
+			return nil
+		}
+	}
+	return errLastAdmin
+}
+
+func writeAdminError(c *gin.Context, err error) {
+	if errors.Is(err, errLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "读取用户失败"})
+}
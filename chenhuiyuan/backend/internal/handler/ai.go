@@ -2,9 +2,16 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 
+	"ai-writing-assistant/internal/pkg/account"
 	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/moderation"
+	"ai-writing-assistant/internal/pkg/redact"
+	"ai-writing-assistant/internal/pkg/textdiff"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,16 +33,38 @@ type unifiedAiRequest struct {
 	SelectedText    string `json:"selectedText"`
 	ContextText     string `json:"contextText"`
 	CursorPosition  int    `json:"cursorPosition"`
-	ModelName       string `json:"modelName"` // 新增：指定使用的模型
-	SessionID       string `json:"sessionID"` // 新增：会话ID，用于多轮对话
-	Stream          bool   `json:"stream"`    // 新增：是否启用流式返回
+	ModelName       string `json:"modelName"`   // 新增：指定使用的模型
+	SessionID       string `json:"sessionID"`   // 新增：会话ID，用于多轮对话
+	Stream          bool   `json:"stream"`      // 新增：是否启用流式返回
+	ReturnEdits     bool   `json:"returnEdits"` // 新增：润色时返回逐处修改（仅非流式）
+
+	// 服务端上下文：指定documentId时由服务端根据已保存的文档构建选中文本、上下文和文档摘要
+	DocumentID     string `json:"documentId"`
+	SelectionStart *int   `json:"selectionStart"` // 选区起点（字符偏移），为空时使用cursorPosition
+	SelectionEnd   *int   `json:"selectionEnd"`   // 选区终点（字符偏移，不含）
+
+	UseRetrieval bool `json:"useRetrieval"` // 新增：续写、生成时检索用户的其他文档作为参考
+
+	references string // 检索到的参考资料，由attachReferences填充
+	style      string // 用户的写作风格要求，由applyStyleProfile填充
+
+	// 翻译参数
+	SourceLanguage   string `json:"sourceLanguage"`   // 源语言代码，为空或auto时自动识别
+	TargetLanguage   string `json:"targetLanguage"`   // 目标语言代码，为空时中译英、其余译为中文
+	Register         string `json:"register"`         // 语体：formal或informal
+	PreserveMarkdown bool   `json:"preserveMarkdown"` // 保留Markdown格式
+
+	glossary []glossaryTerm // 本次翻译适用的术语，由prepareTranslate填充
 }
 
 // 统一AI响应结构
 type unifiedAiResponse struct {
-	Result       string `json:"result"`
-	FunctionType string `json:"functionType"`
-	ModelName    string `json:"modelName"`
+	Result       string          `json:"result"`
+	FunctionType string          `json:"functionType"`
+	ModelName    string          `json:"modelName"`
+	GenerationID string          `json:"generationId"`
+	Edits        []textdiff.Edit `json:"edits,omitempty"`     // 润色结果相对原文的逐处修改，偏移为UTF-16码元
+	Citations    []citation      `json:"citations,omitempty"` // 引用的参考资料出处
 }
 
 // 模型切换请求
@@ -52,29 +81,35 @@ type switchModelResponse struct {
 
 // 多轮对话请求
 type chatRequest struct {
-	Message   string `json:"message"`
-	SessionID string `json:"sessionID"`
-	ModelName string `json:"modelName"`
+	Message      string `json:"message"`
+	SessionID    string `json:"sessionID"`
+	ModelName    string `json:"modelName"`
+	UseRetrieval bool   `json:"useRetrieval"` // 检索用户的文档作为参考
+	UseTools     bool   `json:"useTools"`     // 允许模型调用服务端工具
+	Stream       bool   `json:"stream"`       // 使用工具时通过SSE推送工具调用过程
 }
 
 // 多轮对话响应
 type chatResponse struct {
-	Result    string `json:"result"`
-	ModelName string `json:"modelName"`
+	Result       string         `json:"result"`
+	ModelName    string         `json:"modelName"`
+	GenerationID string         `json:"generationId"`
+	Citations    []citation     `json:"citations,omitempty"`
+	ToolEvents   []ai.ToolEvent `json:"toolEvents,omitempty"` // 工具调用过程
 }
 
-func registerAIRoutes(g *gin.RouterGroup) {
-	svc := ai.NewService()
+func registerAIRoutes(g *gin.RouterGroup, svc *ai.Service, jobs *ai.JobQueue, gens *ai.GenerationRegistry, summaries *documentSummarizer, index *documentIndex) {
+	// 长时任务走异步队列
+	registerAIJobRoutes(g, svc, jobs, summaries)
+
+	// 多模型对比
+	registerAICompareRoutes(g, svc, summaries)
 
-	// 注册AI提供者
-	svc.Register("mock", ai.MockProvider{})
-	// svc.Register("tongyi", ai.NewTongyiProvider())
-	svc.Register("deepseek", ai.NewDeepSeekProvider())
-	// svc.Register("wenxin", ai.NewWenxinProvider())
+	// 翻译术语表
+	registerGlossaryRoutes(g)
 
-	// 使用配置管理系统设置默认模型
-	config := ai.GetAIConfig()
-	svc.Use(config.AI.DefaultModel)
+	// 写作风格档案
+	registerStyleRoutes(g)
 
 	// 获取可用模型列表
 	g.GET("/ai/models", func(c *gin.Context) {
@@ -85,86 +120,57 @@ func registerAIRoutes(g *gin.RouterGroup) {
 		})
 	})
 
-	// 切换AI模型
-	g.POST("/ai/switch-model", func(c *gin.Context) {
-		var req switchModelRequest
+	// 多轮对话接口
+	g.POST("/ai/chat", func(c *gin.Context) {
+		var req chatRequest
 		if err := c.BindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
 			return
 		}
 
-		// 检查模型是否可用
-		models := svc.GetAvailableModels()
-		var targetModel *ai.ModelInfo
-		for _, model := range models {
-			if model.Name == req.ModelName {
-				targetModel = &model
-				break
-			}
-		}
-
-		if targetModel == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "模型不存在"})
+		// 指定的模型只用于本次请求，全局默认模型由管理员设置
+		currentProvider, providerName, ok := requestProvider(c, svc, req.ModelName)
+		if !ok {
 			return
 		}
 
-		if !targetModel.IsAvailable {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "模型不可用"})
+		// 检索参考资料附加到本轮消息中
+		message := req.Message
+		var citations []citation
+		if (req.UseRetrieval || req.UseTools) && !requireDocumentScope(c, account.ScopeDocumentsRead) {
 			return
 		}
-
-		// 切换模型
-		svc.Use(targetModel.Provider)
-
-		c.JSON(http.StatusOK, switchModelResponse{
-			Success:   true,
-			Message:   "模型切换成功",
-			ModelName: req.ModelName,
-		})
-	})
-
-	// 多轮对话接口
-	g.POST("/ai/chat", func(c *gin.Context) {
-		var req chatRequest
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
-			return
+		if req.UseRetrieval {
+			citations = index.References(c.Request.Context(), c.GetString("username"), req.Message, "")
+			message = withReferences(formatReferences(citations), message)
 		}
 
-		// 如果指定了模型，先切换
-		if req.ModelName != "" && req.ModelName != svc.GetCurrentModel() {
-			// 根据模型名称找到对应的provider
-			models := svc.GetAvailableModels()
-			var targetProvider string
-			for _, model := range models {
-				if model.Name == req.ModelName {
-					targetProvider = model.Provider
-					break
-				}
-			}
-
-			if targetProvider != "" {
-				svc.Use(targetProvider)
-			}
-		}
-
-		// 检查当前provider是否可用
-		currentProvider := svc.CurrentProvider()
-		if currentProvider == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "当前AI模型不可用，请先切换模型"})
+		// 使用工具时由模型决定调用哪些服务端工具
+		if req.UseTools {
+			tools := newChatTools(c.GetString("username"), summaries, index, hasScope(c, account.ScopeDocumentsWrite))
+			handleToolChat(c, gens, currentProvider, providerName, req, message, citations, tools)
 			return
 		}
 
 		// 调用多轮对话
-		result, err := currentProvider.Chat(context.Background(), req.Message, req.SessionID)
+		gen, ctx := gens.Start(c.Request.Context(), c.GetString("username"), "chat", providerName)
+		c.Header("X-Generation-ID", gen.ID())
+		result, err := currentProvider.Chat(ctx, message, req.SessionID)
+		gen.Write([]byte(result))
+		gen.Finish(ctx, err)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "AI对话失败: " + err.Error()})
+			if writeCancelled(c, ctx, gen) {
+				return
+			}
+			c.JSON(aiErrorStatus(err), gin.H{"error": "AI对话失败: " + err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, chatResponse{
-			Result:    result,
-			ModelName: svc.GetCurrentModel(),
+			Result:       result,
+			ModelName:    providerName,
+			GenerationID: gen.ID(),
+			Citations:    citations,
 		})
 	})
 
@@ -176,27 +182,37 @@ func registerAIRoutes(g *gin.RouterGroup) {
 			return
 		}
 
-		// 如果指定了模型，先切换
-		if req.ModelName != "" && req.ModelName != svc.GetCurrentModel() {
-			// 根据模型名称找到对应的provider
-			models := svc.GetAvailableModels()
-			var targetProvider string
-			for _, model := range models {
-				if model.Name == req.ModelName {
-					targetProvider = model.Provider
-					break
-				}
-			}
+		// 按功能类型选择脱敏策略
+		c.Request = c.Request.WithContext(redact.WithFunction(c.Request.Context(), req.FunctionType))
 
-			if targetProvider != "" {
-				svc.Use(targetProvider)
-			}
+		// 指定的模型只用于本次请求，全局默认模型由管理员设置
+		currentProvider, providerName, ok := requestProvider(c, svc, req.ModelName)
+		if !ok {
+			return
+		}
+
+		// 根据文档ID在服务端补全上下文
+		if !bindDocumentContext(c, &req, currentProvider, summaries) {
+			return
 		}
 
-		// 检查当前provider是否可用
-		currentProvider := svc.CurrentProvider()
-		if currentProvider == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "当前AI模型不可用，请先切换模型"})
+		// 校对以结构化JSON返回，单独处理
+		if req.FunctionType == "proofread" {
+			handleProofread(c, gens, currentProvider, providerName, req)
+			return
+		}
+
+		if req.UseRetrieval && !requireDocumentScope(c, account.ScopeDocumentsRead) {
+			return
+		}
+
+		// 根据功能类型构建提示词
+		citations := attachReferences(c.Request.Context(), index, c.GetString("username"), &req)
+		applyStyleProfile(c.GetString("username"), &req)
+		prepareTranslate(&req, c.GetString("username"))
+		prompt, ok := buildUnifiedPrompt(req)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的功能类型"})
 			return
 		}
 
@@ -208,76 +224,95 @@ func registerAIRoutes(g *gin.RouterGroup) {
 			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Access-Control-Allow-Headers", "Cache-Control")
 
+			// 生成任务ID通过响应头返回，必须在第一次写入之前设置
+			gen, ctx := gens.Start(c.Request.Context(), c.GetString("username"), req.FunctionType, providerName)
+			c.Header("X-Generation-ID", gen.ID())
+
 			// 创建流式响应
 			streamWriter := &StreamWriter{c: c}
 
-			var prompt string
-			// 根据功能类型构建提示词
-			switch req.FunctionType {
-			case "continue":
-				prompt = buildContinuePrompt(req.DocumentSummary, req.UserRequirement, req.ContextText)
-			case "polish":
-				prompt = buildPolishPrompt(req.UserRequirement, req.SelectedText)
-			case "summarize":
-				prompt = buildSummarizePrompt(req.UserRequirement, req.SelectedText)
-			case "expand":
-				prompt = buildExpandPrompt(req.UserRequirement, req.SelectedText, req.ContextText)
-			case "generate":
-				prompt = buildGeneratePrompt(req.DocumentSummary, req.UserRequirement, req.ContextText)
-			default:
-				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的功能类型"})
-				return
+			// 参考资料出处在生成前以独立事件推送
+			if len(citations) > 0 {
+				c.SSEvent("citations", citations)
+				c.Writer.Flush()
 			}
 
-			// 调用流式AI接口
-			err := currentProvider.CallAIStream(context.Background(), req.FunctionType, prompt, req.SessionID, streamWriter)
-			if err != nil {
+			// 调用流式AI接口，已推送的内容同时记录到生成任务中
+			err := currentProvider.CallAIStream(ctx, req.FunctionType, prompt, req.SessionID, io.MultiWriter(gen, streamWriter))
+			gen.Finish(ctx, err)
+			if errors.Is(context.Cause(ctx), ai.ErrGenerationCancelled) {
+				streamWriter.WriteError(ai.ErrGenerationCancelled.Error())
+			} else if err != nil {
 				streamWriter.WriteError(err.Error())
+			} else if req.FunctionType == "translate" {
+				// 翻译完成后以独立事件推送语言识别和术语校验结果
+				c.SSEvent("translate", gin.H{
+					"sourceLanguage": req.SourceLanguage,
+					"targetLanguage": req.TargetLanguage,
+					"glossary":       checkGlossary(gen.Snapshot().Output, req.glossary),
+				})
+				c.Writer.Flush()
 			}
 			return
 		}
 
 		// 非流式返回（原有逻辑）
-		var result string
-		var err error
-
-		// 根据功能类型调用不同的AI服务
-		switch req.FunctionType {
-		case "continue":
-			// 续写：基于选中文本和上下文进行续写
-			prompt := buildContinuePrompt(req.DocumentSummary, req.UserRequirement, req.ContextText)
-			result, err = currentProvider.ContinueWriting(context.Background(), prompt)
-		case "polish":
-			// 润色：优化选中文本的表达
-			prompt := buildPolishPrompt(req.UserRequirement, req.SelectedText)
-			result, err = currentProvider.PolishText(context.Background(), prompt)
-		case "summarize":
-			// 总结：提取选中文本的核心要点
-			prompt := buildSummarizePrompt(req.UserRequirement, req.SelectedText)
-			result, err = currentProvider.SummarizeText(context.Background(), prompt)
-		case "expand":
-			// 扩写：基于选中文本和上下文进行扩写
-			prompt := buildExpandPrompt(req.UserRequirement, req.SelectedText, req.ContextText)
-			result, err = currentProvider.ContinueWriting(context.Background(), prompt)
-		case "generate":
-			// 生成：根据用户要求生成新内容
-			prompt := buildGeneratePrompt(req.DocumentSummary, req.UserRequirement, req.ContextText)
-			result, err = currentProvider.ContinueWriting(context.Background(), prompt)
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的功能类型"})
+		gen, ctx := gens.Start(c.Request.Context(), c.GetString("username"), req.FunctionType, providerName)
+		c.Header("X-Generation-ID", gen.ID())
+		result, err := callUnified(ctx, currentProvider, req.FunctionType, prompt)
+		gen.Write([]byte(result))
+		gen.Finish(ctx, err)
+		if err != nil {
+			if writeCancelled(c, ctx, gen) {
+				return
+			}
+			c.JSON(aiErrorStatus(err), gin.H{"error": "AI处理失败: " + err.Error()})
 			return
 		}
 
+		resp := unifiedAiResponse{
+			Result:       result,
+			FunctionType: req.FunctionType,
+			ModelName:    providerName,
+			GenerationID: gen.ID(),
+			Citations:    citations,
+		}
+		if req.ReturnEdits && req.FunctionType == "polish" {
+			resp.Edits = buildPolishEdits(req.SelectedText, result)
+		}
+		if req.FunctionType == "translate" {
+			c.JSON(http.StatusOK, translateResponse{
+				unifiedAiResponse: resp,
+				SourceLanguage:    req.SourceLanguage,
+				TargetLanguage:    req.TargetLanguage,
+				Glossary:          checkGlossary(result, req.glossary),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// 查询生成任务（含已生成的部分内容）
+	g.GET("/ai/generations/:id", func(c *gin.Context) {
+		info, err := gens.Get(c.Param("id"), c.GetString("username"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "AI处理失败: " + err.Error()})
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(http.StatusOK, info)
+	})
 
-		c.JSON(http.StatusOK, unifiedAiResponse{
-			Result:       result,
-			FunctionType: req.FunctionType,
-			ModelName:    svc.GetCurrentModel(),
-		})
+	// 取消进行中的生成任务，返回取消时已生成的内容
+	g.POST("/ai/generations/:id/cancel", func(c *gin.Context) {
+		info, err := gens.Cancel(c.Param("id"), c.GetString("username"))
+		switch {
+		case errors.Is(err, ai.ErrGenerationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ai.ErrGenerationFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "generation": info})
+		default:
+			c.JSON(http.StatusOK, info)
+		}
 	})
 
 	// 保持原有接口兼容性
@@ -288,13 +323,12 @@ func registerAIRoutes(g *gin.RouterGroup) {
 			return
 		}
 
-		currentProvider := svc.CurrentProvider()
-		if currentProvider == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "当前AI模型不可用，请先切换模型"})
+		currentProvider, _, ok := requestProvider(c, svc, "")
+		if !ok {
 			return
 		}
 
-		result, err := currentProvider.ContinueWriting(context.Background(), req.Prompt)
+		result, err := currentProvider.ContinueWriting(c.Request.Context(), req.Prompt)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "AI处理失败: " + err.Error()})
 			return
@@ -309,13 +343,12 @@ func registerAIRoutes(g *gin.RouterGroup) {
 			return
 		}
 
-		currentProvider := svc.CurrentProvider()
-		if currentProvider == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "当前AI模型不可用，请先切换模型"})
+		currentProvider, _, ok := requestProvider(c, svc, "")
+		if !ok {
 			return
 		}
 
-		result, err := currentProvider.PolishText(context.Background(), req.Text)
+		result, err := currentProvider.PolishText(c.Request.Context(), req.Text)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "AI处理失败: " + err.Error()})
 			return
@@ -330,13 +363,12 @@ func registerAIRoutes(g *gin.RouterGroup) {
 			return
 		}
 
-		currentProvider := svc.CurrentProvider()
-		if currentProvider == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "当前AI模型不可用，请先切换模型"})
+		currentProvider, _, ok := requestProvider(c, svc, "")
+		if !ok {
 			return
 		}
 
-		result, err := currentProvider.SummarizeText(context.Background(), req.Text)
+		result, err := currentProvider.SummarizeText(c.Request.Context(), req.Text)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "AI处理失败: " + err.Error()})
 			return
@@ -345,6 +377,52 @@ func registerAIRoutes(g *gin.RouterGroup) {
 	})
 }
 
+// 生成被主动取消时返回已生成的部分内容，返回值表示是否已写出响应
+func writeCancelled(c *gin.Context, ctx context.Context, gen *ai.Generation) bool {
+	if !errors.Is(context.Cause(ctx), ai.ErrGenerationCancelled) {
+		return false
+	}
+	info := gen.Snapshot()
+	c.JSON(http.StatusConflict, gin.H{
+		"error":        ai.ErrGenerationCancelled.Error(),
+		"generationId": info.ID,
+		"partial":      info.Output,
+	})
+	return true
+}
+
+// 选择本次请求使用的模型：指定了已注册的模型名时使用该模型，否则使用全局默认模型。
+// 模型不健康时拒绝请求，失败时已写入响应
+func requestProvider(c *gin.Context, svc *ai.Service, modelName string) (ai.Provider, string, bool) {
+	name := svc.GetCurrentModel()
+	if modelName != "" {
+		if resolved, ok := svc.ResolveModel(modelName); ok {
+			name = resolved
+		}
+	}
+	p := svc.Provider(name)
+	if p == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "当前AI模型不可用，请联系管理员切换模型"})
+		return nil, "", false
+	}
+	if err := svc.CheckAvailable(name); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	return p, name, true
+}
+
+// AI调用失败时的状态码：内容被审核拦截时为422，模型不健康时为503，其余为500
+func aiErrorStatus(err error) int {
+	if errors.Is(err, moderation.ErrBlocked) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, ai.ErrProviderUnhealthy) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 // 流式写入器
 type StreamWriter struct {
 	c *gin.Context
@@ -362,6 +440,58 @@ func (sw *StreamWriter) WriteError(message string) {
 	sw.c.Writer.Flush()
 }
 
+// 根据功能类型构建提示词
+func buildUnifiedPrompt(req unifiedAiRequest) (string, bool) {
+	switch req.FunctionType {
+	case "continue":
+		// 续写：基于选中文本和上下文进行续写
+		return withReferences(req.references, withStyle(req.style, buildContinuePrompt(req.DocumentSummary, req.UserRequirement, req.ContextText))), true
+	case "polish":
+		// 润色：优化选中文本的表达
+		return buildPolishPrompt(req.UserRequirement, req.SelectedText), true
+	case "summarize":
+		// 总结：提取选中文本的核心要点
+		return buildSummarizePrompt(req.UserRequirement, req.SelectedText), true
+	case "expand":
+		// 扩写：基于选中文本和上下文进行扩写
+		return withStyle(req.style, buildExpandPrompt(req.UserRequirement, req.SelectedText, req.ContextText)), true
+	case "generate":
+		// 生成：根据用户要求生成新内容
+		return withReferences(req.references, withStyle(req.style, buildGeneratePrompt(req.DocumentSummary, req.UserRequirement, req.ContextText))), true
+	case "translate":
+		// 翻译：按目标语言、语体和术语表翻译选中文本
+		return buildTranslatePrompt(req), true
+	}
+	return "", false
+}
+
+// 根据功能类型调用不同的AI服务（非流式）
+func callUnified(ctx context.Context, p ai.Provider, functionType, prompt string) (string, error) {
+	switch functionType {
+	case "polish":
+		return p.PolishText(ctx, prompt)
+	case "summarize":
+		return p.SummarizeText(ctx, prompt)
+	case "translate":
+		// 翻译没有专用接口，使用通用系统提示词调用
+		var buf strings.Builder
+		err := p.CallAIStream(ctx, functionType, prompt, "", &buf)
+		return buf.String(), err
+	default:
+		// 续写、扩写、生成均使用续写接口
+		return p.ContinueWriting(ctx, prompt)
+	}
+}
+
+// 计算润色结果相对原文的修改，便于前端逐处接受或拒绝
+func buildPolishEdits(original, polished string) []textdiff.Edit {
+	// 模型输出常带有首尾换行，原文本身没有首尾空白时忽略这部分差异
+	if strings.TrimSpace(original) == original {
+		polished = strings.TrimSpace(polished)
+	}
+	return textdiff.Compute(original, polished)
+}
+
 // 构建续写提示词
 func buildContinuePrompt(documentSummary, userRequirement, contextText string) string {
 	return "续写要求：" + userRequirement + "\n\n" +
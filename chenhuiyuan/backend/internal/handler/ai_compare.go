@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/ai"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单次对比最多同时调用的模型数
+const maxCompareModels = 5
+
+// 多模型对比请求，Models为模型名或提供者注册名
+type compareRequest struct {
+	unifiedAiRequest
+	Models []string `json:"models"`
+}
+
+// 单个模型的对比结果
+type compareResult struct {
+	ModelName    string        `json:"modelName"`
+	Provider     string        `json:"provider"`
+	Result       string        `json:"result"`
+	Error        string        `json:"error,omitempty"`
+	LatencyMs    int64         `json:"latencyMs"`
+	FirstTokenMs int64         `json:"firstTokenMs,omitempty"`
+	Usage        ai.TokenUsage `json:"usage"`
+}
+
+// 一次对比记录
+type comparison struct {
+	ID               string          `json:"id"`
+	Owner            string          `json:"-"`
+	FunctionType     string          `json:"functionType"`
+	Results          []compareResult `json:"results"`
+	Preferred        string          `json:"preferred,omitempty"`
+	PreferenceReason string          `json:"preferenceReason,omitempty"`
+	CreatedAt        time.Time       `json:"createdAt"`
+}
+
+// 对比记录保留时长，超时后无法再记录偏好
+const comparisonRetention = 24 * time.Hour
+
+var (
+	comparisonsMu sync.Mutex
+	comparisons   = make(map[string]*comparison)
+	// 各模型被选为更优输出的累计次数
+	preferenceCounts = make(map[string]int)
+)
+
+// 对比目标
+type compareTarget struct {
+	modelName string
+	provider  string
+	p         ai.Provider
+}
+
+// 流式对比时推送给客户端的事件
+type compareEvent struct {
+	name string
+	data any
+}
+
+func registerAICompareRoutes(g *gin.RouterGroup, svc *ai.Service, summaries *documentSummarizer) {
+	// 同一请求并发调用多个模型，返回或流式推送各自结果
+	g.POST("/ai/compare", func(c *gin.Context) {
+		var req compareRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+
+		targets, errMsg := resolveCompareTargets(svc, req.Models)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+
+		// 按各模型中最小的上下文上限构建文档上下文
+		smallest := targets[0].p
+		for _, t := range targets[1:] {
+			if t.p.GetModelInfo().MaxTokens < smallest.GetModelInfo().MaxTokens {
+				smallest = t.p
+			}
+		}
+		if !bindDocumentContext(c, &req.unifiedAiRequest, smallest, summaries) {
+			return
+		}
+		prepareTranslate(&req.unifiedAiRequest, c.GetString("username"))
+		prompt, ok := buildUnifiedPrompt(req.unifiedAiRequest)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的功能类型"})
+			return
+		}
+
+		cmp := &comparison{
+			ID:           newComparisonID(),
+			Owner:        c.GetString("username"),
+			FunctionType: req.FunctionType,
+			CreatedAt:    time.Now(),
+		}
+
+		if !req.Stream {
+			cmp.Results = runComparison(c.Request.Context(), targets, req.FunctionType, prompt, nil)
+			saveComparison(cmp)
+			c.JSON(http.StatusOK, cmp)
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.SSEvent("start", gin.H{"id": cmp.ID, "models": targetNames(targets)})
+		c.Writer.Flush()
+
+		// 各模型的输出由多个goroutine产生，统一在此处串行写出
+		events := make(chan compareEvent, 64)
+		go func() {
+			cmp.Results = runComparison(c.Request.Context(), targets, req.FunctionType, prompt, events)
+			close(events)
+		}()
+		for ev := range events {
+			c.SSEvent(ev.name, ev.data)
+			c.Writer.Flush()
+		}
+
+		saveComparison(cmp)
+		c.SSEvent("done", cmp)
+		c.Writer.Flush()
+	})
+
+	// 各模型被选为更优输出的累计次数
+	g.GET("/ai/compare/stats", func(c *gin.Context) {
+		comparisonsMu.Lock()
+		counts := make(map[string]int, len(preferenceCounts))
+		total := 0
+		for model, n := range preferenceCounts {
+			counts[model] = n
+			total += n
+		}
+		comparisonsMu.Unlock()
+		c.JSON(http.StatusOK, gin.H{"preferences": counts, "total": total})
+	})
+
+	// 查询对比记录
+	g.GET("/ai/compare/:id", func(c *gin.Context) {
+		comparisonsMu.Lock()
+		defer comparisonsMu.Unlock()
+		cmp, ok := comparisons[c.Param("id")]
+		if !ok || cmp.Owner != c.GetString("username") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "对比记录不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, cmp)
+	})
+
+	// 记录用户更偏好的输出，重复提交时以最后一次为准
+	g.POST("/ai/compare/:id/preference", func(c *gin.Context) {
+		var req struct {
+			ModelName string `json:"modelName"`
+			Reason    string `json:"reason"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.ModelName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+
+		comparisonsMu.Lock()
+		defer comparisonsMu.Unlock()
+		cmp, ok := comparisons[c.Param("id")]
+		if !ok || cmp.Owner != c.GetString("username") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "对比记录不存在"})
+			return
+		}
+		found := false
+		for _, r := range cmp.Results {
+			if r.ModelName == req.ModelName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该模型不在本次对比中"})
+			return
+		}
+
+		if cmp.Preferred != "" {
+			preferenceCounts[cmp.Preferred]--
+		}
+		cmp.Preferred = req.ModelName
+		cmp.PreferenceReason = req.Reason
+		preferenceCounts[req.ModelName]++
+		c.JSON(http.StatusOK, cmp)
+	})
+}
+
+// 解析并去重对比目标，返回错误信息为空表示成功
+func resolveCompareTargets(svc *ai.Service, models []string) ([]compareTarget, string) {
+	seen := make(map[string]bool)
+	targets := make([]compareTarget, 0, len(models))
+	for _, name := range models {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		key, ok := svc.ResolveModel(name)
+		if !ok {
+			key = name
+		}
+		p := svc.Provider(key)
+		if p == nil {
+			return nil, "模型不存在: " + name
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := svc.CheckAvailable(key); err != nil {
+			return nil, name + ": " + err.Error()
+		}
+		targets = append(targets, compareTarget{modelName: p.GetModelInfo().Name, provider: key, p: p})
+	}
+
+	if len(targets) < 2 {
+		return nil, "请至少选择两个不同的模型"
+	}
+	if len(targets) > maxCompareModels {
+		return nil, "单次对比最多选择5个模型"
+	}
+	return targets, ""
+}
+
+// 并发调用所有目标模型，events不为nil时以流式方式调用并推送增量输出
+func runComparison(ctx context.Context, targets []compareTarget, functionType, prompt string, events chan<- compareEvent) []compareResult {
+	results := make([]compareResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t compareTarget) {
+			defer wg.Done()
+			results[i] = runCompareTarget(ctx, t, functionType, prompt, events)
+			if events != nil {
+				events <- compareEvent{name: "result", data: results[i]}
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+func runCompareTarget(ctx context.Context, t compareTarget, functionType, prompt string, events chan<- compareEvent) compareResult {
+	res := compareResult{ModelName: t.modelName, Provider: t.provider}
+	if !t.p.IsAvailable() {
+		res.Error = "模型不可用"
+		return res
+	}
+
+	ctx, usage := ai.WithUsageRecorder(ctx)
+	start := time.Now()
+	var err error
+	if events == nil {
+		res.Result, err = callUnified(ctx, t.p, functionType, prompt)
+	} else {
+		w := &compareStreamWriter{model: t.modelName, start: start, events: events}
+		// 对比调用不使用会话，避免污染用户的对话历史
+		err = t.p.CallAIStream(ctx, functionType, prompt, "", w)
+		res.Result = w.buf.String()
+		res.FirstTokenMs = w.firstToken.Milliseconds()
+	}
+	res.LatencyMs = time.Since(start).Milliseconds()
+	res.Usage = usage.Usage()
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// 把单个模型的流式输出转发为对比事件
+type compareStreamWriter struct {
+	model      string
+	start      time.Time
+	firstToken time.Duration
+	buf        strings.Builder
+	events     chan<- compareEvent
+}
+
+func (w *compareStreamWriter) Write(p []byte) (int, error) {
+	if w.buf.Len() == 0 {
+		w.firstToken = time.Since(w.start)
+	}
+	w.buf.Write(p)
+	w.events <- compareEvent{name: "delta", data: gin.H{"modelName": w.model, "text": string(p)}}
+	return len(p), nil
+}
+
+func saveComparison(cmp *comparison) {
+	comparisonsMu.Lock()
+	defer comparisonsMu.Unlock()
+	cutoff := time.Now().Add(-comparisonRetention)
+	for id, old := range comparisons {
+		if old.CreatedAt.Before(cutoff) {
+			delete(comparisons, id)
+		}
+	}
+	comparisons[cmp.ID] = cmp
+}
+
+func targetNames(targets []compareTarget) []string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.modelName
+	}
+	return names
+}
+
+func newComparisonID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "cmp_" + hex.EncodeToString(b)
+}
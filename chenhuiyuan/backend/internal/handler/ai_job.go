@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"ai-writing-assistant/internal/pkg/ai"
+
+	"github.com/gin-gonic/gin"
+)
+
+func registerAIJobRoutes(g *gin.RouterGroup, svc *ai.Service, jobs *ai.JobQueue, summaries *documentSummarizer) {
+	// 提交异步任务，立即返回任务ID
+	g.POST("/ai/jobs", func(c *gin.Context) {
+		var req unifiedAiRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+
+		// 任务使用提交时指定的模型，不影响全局当前模型
+		provider := svc.GetCurrentModel()
+		if req.ModelName != "" {
+			name, ok := svc.ResolveModel(req.ModelName)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "模型不存在"})
+				return
+			}
+			provider = name
+		}
+		if err := svc.CheckAvailable(provider); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !bindDocumentContext(c, &req, svc.Provider(provider), summaries) {
+			return
+		}
+		applyStyleProfile(c.GetString("username"), &req)
+		prepareTranslate(&req, c.GetString("username"))
+		prompt, ok := buildUnifiedPrompt(req)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的功能类型"})
+			return
+		}
+
+		info, err := jobs.Submit(c.Request.Context(), c.GetString("username"), ai.JobSpec{
+			Provider:     provider,
+			FunctionType: req.FunctionType,
+			Prompt:       prompt,
+			SessionID:    req.SessionID,
+		})
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, info)
+	})
+
+	// 当前用户的任务列表
+	g.GET("/ai/jobs", func(c *gin.Context) {
+		c.JSON(http.StatusOK, jobs.List(c.GetString("username")))
+	})
+
+	// 轮询任务状态
+	g.GET("/ai/jobs/:id", func(c *gin.Context) {
+		job, err := jobs.Get(c.Param("id"), c.GetString("username"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job.Snapshot())
+	})
+
+	// 通过SSE订阅任务进度：status为状态变化，delta为新增输出，done为最终结果
+	g.GET("/ai/jobs/:id/events", func(c *gin.Context) {
+		job, err := jobs.Get(c.Param("id"), c.GetString("username"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+
+		offset := 0
+		var lastStatus ai.JobStatus
+		for {
+			delta, info, changed := job.Watch(offset)
+			if info.Status != lastStatus {
+				lastStatus = info.Status
+				c.SSEvent("status", gin.H{"id": info.ID, "status": info.Status})
+			}
+			if delta != "" {
+				offset += len(delta)
+				c.SSEvent("delta", gin.H{"text": delta})
+			}
+			if info.Status.Finished() {
+				c.SSEvent("done", info)
+				c.Writer.Flush()
+				return
+			}
+			c.Writer.Flush()
+
+			select {
+			case <-changed:
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	})
+
+	// 取消排队中或执行中的任务
+	g.POST("/ai/jobs/:id/cancel", func(c *gin.Context) {
+		info, err := jobs.Cancel(c.Param("id"), c.GetString("username"))
+		switch {
+		case errors.Is(err, ai.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ai.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": info})
+		default:
+			c.JSON(http.StatusOK, info)
+		}
+	})
+}
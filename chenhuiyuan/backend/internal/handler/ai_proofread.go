@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"ai-writing-assistant/internal/pkg/ai"
+
+	"github.com/gin-gonic/gin"
+)
+
+const proofreadSystemPrompt = `你是专业的中文校对编辑，负责找出文本中的错别字、语法错误、标点错误和不当用词。
+只报告确实存在的问题，不要改写文风。请以JSON对象输出，格式如下：
+{"issues":[{"type":"typo|grammar|punctuation|wording|other","original":"原文中有问题的片段，必须与原文逐字一致","start":片段在原文中的字符偏移,"suggestion":"修改后的片段","explanation":"简要说明"}]}
+没有问题时输出{"issues":[]}。`
+
+// 支持的校对问题类型
+var proofreadIssueTypes = map[string]bool{
+	"typo":        true, // 错别字
+	"grammar":     true, // 语法
+	"punctuation": true, // 标点
+	"wording":     true, // 用词
+	"other":       true,
+}
+
+// 校对问题，Start/End为原文中的字符（Unicode码点）偏移，左闭右开
+type proofreadIssue struct {
+	Type        string `json:"type"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Original    string `json:"original"`
+	Suggestion  string `json:"suggestion"`
+	Explanation string `json:"explanation"`
+}
+
+// 校对响应，Result为应用全部建议后的文本
+type proofreadResponse struct {
+	unifiedAiResponse
+	Issues []proofreadIssue `json:"issues"`
+}
+
+// 模型返回的校对结果
+type proofreadOutput struct {
+	Issues []struct {
+		Type        string `json:"type"`
+		Original    string `json:"original"`
+		Start       *int   `json:"start"`
+		Suggestion  string `json:"suggestion"`
+		Explanation string `json:"explanation"`
+	} `json:"issues"`
+}
+
+// 校对：要求模型以JSON输出问题列表，校验后映射回原文位置
+func handleProofread(c *gin.Context, gens *ai.GenerationRegistry, p ai.Provider, modelName string, req unifiedAiRequest) {
+	if req.Stream {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "校对不支持流式返回"})
+		return
+	}
+	if strings.TrimSpace(req.SelectedText) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择需要校对的文本"})
+		return
+	}
+
+	gen, ctx := gens.Start(c.Request.Context(), c.GetString("username"), req.FunctionType, modelName)
+	c.Header("X-Generation-ID", gen.ID())
+	raw, err := ai.CompleteJSON(ctx, p, proofreadSystemPrompt, buildProofreadPrompt(req.UserRequirement, req.SelectedText))
+	gen.Write([]byte(raw))
+	gen.Finish(ctx, err)
+	if err != nil {
+		if writeCancelled(c, ctx, gen) {
+			return
+		}
+		c.JSON(aiErrorStatus(err), gin.H{"error": "AI处理失败: " + err.Error()})
+		return
+	}
+
+	issues, err := parseProofreadIssues(req.SelectedText, raw)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, proofreadResponse{
+		unifiedAiResponse: unifiedAiResponse{
+			Result:       applyProofreadIssues(req.SelectedText, issues),
+			FunctionType: req.FunctionType,
+			ModelName:    modelName,
+			GenerationID: gen.ID(),
+		},
+		Issues: issues,
+	})
+}
+
+// 构建校对提示词
+func buildProofreadPrompt(userRequirement, selectedText string) string {
+	return "校对要求：" + userRequirement + "\n\n" +
+		"原文：" + selectedText
+}
+
+// 解析并校验模型输出，丢弃无法在原文中定位的问题，返回按位置排序且互不重叠的问题列表
+func parseProofreadIssues(text, raw string) ([]proofreadIssue, error) {
+	var out proofreadOutput
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, fmt.Errorf("模型返回的校对结果不是有效的JSON: %w", err)
+	}
+
+	issues := make([]proofreadIssue, 0, len(out.Issues))
+	used := make(map[int]bool)
+	for _, it := range out.Issues {
+		if it.Original == "" || it.Original == it.Suggestion {
+			continue
+		}
+		hint := -1
+		if it.Start != nil {
+			hint = *it.Start
+		}
+		start, ok := locateSpan(text, it.Original, hint, used)
+		if !ok {
+			continue
+		}
+		used[start] = true
+
+		typ := strings.ToLower(strings.TrimSpace(it.Type))
+		if !proofreadIssueTypes[typ] {
+			typ = "other"
+		}
+		issues = append(issues, proofreadIssue{
+			Type:        typ,
+			Start:       start,
+			End:         start + utf8.RuneCountInString(it.Original),
+			Original:    it.Original,
+			Suggestion:  it.Suggestion,
+			Explanation: it.Explanation,
+		})
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Start < issues[j].Start })
+	result := issues[:0]
+	lastEnd := 0
+	for _, is := range issues {
+		if is.Start < lastEnd {
+			continue
+		}
+		result = append(result, is)
+		lastEnd = is.End
+	}
+	return result, nil
+}
+
+// 在原文中查找片段，多处出现时取未被占用且最接近模型给出偏移的位置，返回字符偏移
+func locateSpan(text, fragment string, hint int, used map[int]bool) (int, bool) {
+	best, bestDist := -1, -1
+	byteStart, runeStart := 0, 0
+	for {
+		i := strings.Index(text[byteStart:], fragment)
+		if i < 0 {
+			break
+		}
+		runeStart += utf8.RuneCountInString(text[byteStart : byteStart+i])
+		byteStart += i
+		if !used[runeStart] {
+			dist := 0
+			if hint >= 0 {
+				dist = runeStart - hint
+				if dist < 0 {
+					dist = -dist
+				}
+			}
+			if best < 0 || dist < bestDist {
+				best, bestDist = runeStart, dist
+			}
+			if hint < 0 {
+				break
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text[byteStart:])
+		byteStart += size
+		runeStart++
+	}
+	return best, best >= 0
+}
+
+// 将全部建议应用到原文，issues需按位置排序且互不重叠
+func applyProofreadIssues(text string, issues []proofreadIssue) string {
+	runes := []rune(text)
+	var b strings.Builder
+	last := 0
+	for _, is := range issues {
+		b.WriteString(string(runes[last:is.Start]))
+		b.WriteString(is.Suggestion)
+		last = is.End
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String()
+}
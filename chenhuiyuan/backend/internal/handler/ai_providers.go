@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/moderation"
+	"ai-writing-assistant/internal/pkg/redact"
+)
+
+// 可注册的AI提供者
+type providerSpec struct {
+	name       string
+	thirdParty bool                                  // 第三方提供者在发送前对个人信息脱敏
+	config     func(cfg *ai.AIConfig) ai.ModelConfig // 提供者自身的配置，变化时重建该提供者
+	build      func(cfg ai.ModelConfig) ai.Provider
+}
+
+var providerSpecs = []providerSpec{
+	{
+		name:  "mock",
+		build: func(ai.ModelConfig) ai.Provider { return ai.MockProvider{} },
+	},
+	// {
+	// 	name:       "tongyi",
+	// 	thirdParty: true,
+	// 	config:     func(cfg *ai.AIConfig) ai.ModelConfig { return cfg.AI.Tongyi },
+	// 	build:      func(cfg ai.ModelConfig) ai.Provider { return ai.NewTongyiProvider(cfg) },
+	// },
+	{
+		name:       "deepseek",
+		thirdParty: true,
+		config:     func(cfg *ai.AIConfig) ai.ModelConfig { return cfg.AI.DeepSeek },
+		build:      func(cfg ai.ModelConfig) ai.Provider { return ai.NewDeepSeekProvider(cfg) },
+	},
+	// {
+	// 	name:       "wenxin",
+	// 	thirdParty: true,
+	// 	config:     func(cfg *ai.AIConfig) ai.ModelConfig { return cfg.AI.Wenxin },
+	// 	build:      func(cfg ai.ModelConfig) ai.Provider { return ai.NewWenxinProvider(cfg) },
+	// },
+}
+
+// 创建AI服务并注册提供者，配置重新加载后重建受影响的提供者
+func newAIService(manager *ai.ConfigManager, audit *moderation.AuditLog) (*ai.Service, error) {
+	config := manager.Current()
+	svc := ai.NewService()
+	providers := make(providerStacks)
+	if err := providers.register(svc, nil, config, audit); err != nil {
+		return nil, err
+	}
+
+	// 使用配置管理系统设置默认模型
+	svc.Use(config.AI.DefaultModel)
+
+	// 后台定期探测各提供者，模型列表和模型选择据此判断是否可用
+	svc.StartHealthChecks(config.AI.Health)
+
+	manager.OnValidate(func(cfg *ai.AIConfig) error {
+		if _, err := newProviderWrappers(cfg, nil); err != nil {
+			return err
+		}
+		for _, spec := range providerSpecs {
+			if spec.name == cfg.AI.DefaultModel {
+				return nil
+			}
+		}
+		return fmt.Errorf("默认模型不存在: %s", cfg.AI.DefaultModel)
+	})
+	manager.OnChange(func(old, cfg *ai.AIConfig) {
+		// 已通过校验，这里不会失败
+		if err := providers.register(svc, old, cfg, audit); err != nil {
+			slog.Error("重建AI提供者失败", logging.Err(err))
+			return
+		}
+		if cfg.AI.DefaultModel != old.AI.DefaultModel {
+			svc.Use(cfg.AI.DefaultModel)
+		}
+		if cfg.AI.Health != old.AI.Health {
+			svc.StopHealthChecks()
+			svc.StartHealthChecks(cfg.AI.Health)
+		} else {
+			go svc.ProbeAll(context.Background())
+		}
+	})
+	return svc, nil
+}
+
+// 提供者共用的审核器和默认脱敏策略
+type providerWrappers struct {
+	moderator *moderation.Moderator
+	redaction redact.Policy
+}
+
+func newProviderWrappers(cfg *ai.AIConfig, audit *moderation.AuditLog) (providerWrappers, error) {
+	moderator, err := moderation.New(cfg.AI.Moderation, audit)
+	if err != nil {
+		return providerWrappers{}, fmt.Errorf("加载敏感词配置失败: %w", err)
+	}
+	redaction, err := redact.PolicyFromConfig(cfg.AI.Redaction)
+	if err != nil {
+		return providerWrappers{}, fmt.Errorf("加载脱敏配置失败: %w", err)
+	}
+	return providerWrappers{moderator: moderator, redaction: redaction}, nil
+}
+
+// 每个提供者的各层实例：base为提供者本身（DeepSeek在其中保存多轮对话历史），
+// redacted为第三方提供者的脱敏层，未脱敏时与base相同
+type providerStack struct {
+	base     ai.Provider
+	redacted ai.Provider
+}
+
+// 注册名 -> 当前使用的各层实例，只在创建服务和配置变化时访问
+type providerStacks map[string]*providerStack
+
+// 按配置创建并注册提供者：启用内容审核时所有提供者都经过审核，第三方提供者在审核之后、
+// 发送之前对个人信息脱敏。old不为nil时只替换受配置变化影响的那一层：
+// 提供者自身的配置变化时整体重建；脱敏配置变化时原地更新默认策略；
+// 审核配置变化时只重建审核层，保留对话历史。变化的提供者在同一次加锁中一起替换，
+// 进行中的请求继续使用旧实例直到结束
+func (stacks providerStacks) register(svc *ai.Service, old, cfg *ai.AIConfig, audit *moderation.AuditLog) error {
+	w, err := newProviderWrappers(cfg, audit)
+	if err != nil {
+		return err
+	}
+	setRedactionDefaults(w.redaction)
+
+	moderationChanged := old == nil || !reflect.DeepEqual(old.AI.Moderation, cfg.AI.Moderation)
+	redactionChanged := old != nil && !reflect.DeepEqual(old.AI.Redaction, cfg.AI.Redaction)
+	changed := make([]ai.NamedProvider, 0, len(providerSpecs))
+	for _, spec := range providerSpecs {
+		var own ai.ModelConfig
+		if spec.config != nil {
+			own = spec.config(cfg)
+		}
+		stack, ok := stacks[spec.name]
+		rebuild := !ok || (old != nil && spec.config != nil && spec.config(old) != own)
+		if rebuild {
+			stack = &providerStack{base: spec.build(own)}
+			stack.redacted = stack.base
+			if spec.thirdParty {
+				stack.redacted = redact.Wrap(stack.base, w.redaction)
+			}
+			stacks[spec.name] = stack
+		} else if spec.thirdParty && redactionChanged {
+			redact.SetDefaults(stack.redacted, w.redaction)
+		}
+		if !rebuild && !moderationChanged {
+			continue
+		}
+
+		changed = append(changed, ai.NamedProvider{Name: spec.name, Provider: moderation.Wrap(stack.redacted, w.moderator)})
+		if old != nil {
+			slog.Info("配置已变化，替换AI提供者", "model", spec.name, "rebuilt", rebuild)
+		}
+	}
+	svc.RegisterAll(changed)
+	return nil
+}
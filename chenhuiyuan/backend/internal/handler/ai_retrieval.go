@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/retrieval"
+)
+
+// 检索查询中上下文部分的最大长度（取光标前的末尾部分）
+const retrievalQueryRunes = 300
+
+// 参考资料的出处，Index与提示词中的[编号]对应
+type citation struct {
+	Index      int     `json:"index"`
+	DocumentID string  `json:"documentId"`
+	Title      string  `json:"title"`
+	Snippet    string  `json:"snippet"`
+	Start      int     `json:"start"`
+	Score      float64 `json:"score"`
+}
+
+// 按用户维护的文档检索索引
+type documentIndex struct {
+	mu       sync.Mutex
+	cfg      ai.RetrievalConfig
+	embedder retrieval.Embedder
+	indexes  map[string]*retrieval.Index
+}
+
+func newDocumentIndex(cfg ai.RetrievalConfig) *documentIndex {
+	idx := &documentIndex{cfg: cfg, indexes: make(map[string]*retrieval.Index)}
+	if e := ai.NewEmbeddingClient(cfg.Embedding); e != nil {
+		idx.embedder = e
+	}
+	return idx
+}
+
+func (d *documentIndex) index(owner string) *retrieval.Index {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ix, ok := d.indexes[owner]
+	if !ok {
+		ix = retrieval.New(d.embedder)
+		d.indexes[owner] = ix
+	}
+	return ix
+}
+
+// 文档更新时重建该文档的索引
+func (d *documentIndex) Touch(doc Document) {
+	d.index(doc.Owner).Upsert(doc.ID, doc.Title, doc.Content)
+}
+
+// 文档删除时移出索引
+func (d *documentIndex) Forget(owner, id string) {
+	d.index(owner).Remove(id)
+}
+
+// 账号删除时丢弃该用户的整个索引
+func (d *documentIndex) Drop(owner string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.indexes, owner)
+}
+
+// 在用户的其他文档中检索与query相关的片段，按token预算截取并编号
+func (d *documentIndex) References(ctx context.Context, owner, query, excludeDoc string) []citation {
+	results := d.index(owner).Search(ctx, query, d.cfg.TopK, excludeDoc)
+	citations := make([]citation, 0, len(results))
+	budget := d.cfg.MaxTokens
+	for _, r := range results {
+		cost := ai.EstimateTokens(r.Text)
+		if budget > 0 && cost > budget {
+			break
+		}
+		budget -= cost
+		citations = append(citations, citation{
+			Index:      len(citations) + 1,
+			DocumentID: r.DocumentID,
+			Title:      r.Title,
+			Snippet:    r.Text,
+			Start:      r.Start,
+			Score:      r.Score,
+		})
+	}
+	return citations
+}
+
+// 续写、生成时检索用户的其他文档作为参考，结果写入req并返回出处
+func attachReferences(ctx context.Context, idx *documentIndex, owner string, req *unifiedAiRequest) []citation {
+	if !req.UseRetrieval || (req.FunctionType != "continue" && req.FunctionType != "generate") {
+		return nil
+	}
+	tail := []rune(req.ContextText)
+	if len(tail) > retrievalQueryRunes {
+		tail = tail[len(tail)-retrievalQueryRunes:]
+	}
+	query := strings.Join([]string{req.UserRequirement, req.SelectedText, string(tail)}, "\n")
+	citations := idx.References(ctx, owner, query, req.DocumentID)
+	req.references = formatReferences(citations)
+	return citations
+}
+
+// 把参考片段拼接为提示词中的参考资料部分
+func formatReferences(citations []citation) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("参考资料（来自用户的其他文档，引用其中内容时请在句末标注对应编号，如[1]）：\n")
+	for _, c := range citations {
+		fmt.Fprintf(&b, "[%d] 《%s》\n%s\n", c.Index, c.Title, c.Snippet)
+	}
+	return b.String()
+}
+
+// 在提示词前附加参考资料
+func withReferences(references, prompt string) string {
+	if references == "" {
+		return prompt
+	}
+	return references + "\n" + prompt
+}
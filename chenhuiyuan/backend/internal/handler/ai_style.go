@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/style"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户的写作风格档案
+type styleProfile struct {
+	style.Profile
+	Enabled   bool      `json:"enabled"` // 是否应用到续写、扩写、生成的提示词中
+	Notes     string    `json:"notes"`   // 用户补充的风格说明
+	BuiltAt   time.Time `json:"builtAt"` // 最近一次根据文档统计的时间
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// 风格档案编辑请求，字段为空表示不修改
+type styleProfileUpdate struct {
+	Enabled    *bool     `json:"enabled"`
+	Notes      *string   `json:"notes"`
+	Tone       *[]string `json:"tone"`
+	Vocabulary *[]string `json:"vocabulary"`
+	Excerpts   *[]string `json:"excerpts"`
+}
+
+var (
+	styleMu       sync.Mutex
+	styleProfiles = make(map[string]*styleProfile)
+)
+
+func registerStyleRoutes(g *gin.RouterGroup) {
+	// 获取风格档案，首次访问时根据已有文档生成
+	g.GET("/ai/style-profile", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getStyleProfile(c.GetString("username")))
+	})
+
+	// 根据当前文档重新统计，保留启用状态和补充说明
+	g.POST("/ai/style-profile/rebuild", func(c *gin.Context) {
+		c.JSON(http.StatusOK, rebuildStyleProfile(c.GetString("username")))
+	})
+
+	// 编辑风格档案
+	g.PUT("/ai/style-profile", func(c *gin.Context) {
+		var req styleProfileUpdate
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+
+		owner := c.GetString("username")
+		getStyleProfile(owner)
+		styleMu.Lock()
+		p := styleProfiles[owner]
+		if req.Enabled != nil {
+			p.Enabled = *req.Enabled
+		}
+		if req.Notes != nil {
+			p.Notes = strings.TrimSpace(*req.Notes)
+		}
+		if req.Tone != nil {
+			p.Tone = compactStrings(*req.Tone)
+		}
+		if req.Vocabulary != nil {
+			p.Vocabulary = compactStrings(*req.Vocabulary)
+		}
+		if req.Excerpts != nil {
+			p.Excerpts = compactStrings(*req.Excerpts)
+		}
+		p.UpdatedAt = time.Now()
+		updated := *p
+		styleMu.Unlock()
+		c.JSON(http.StatusOK, updated)
+	})
+}
+
+// 获取风格档案副本，不存在时先生成
+func getStyleProfile(owner string) styleProfile {
+	styleMu.Lock()
+	p, ok := styleProfiles[owner]
+	if ok {
+		defer styleMu.Unlock()
+		return *p
+	}
+	styleMu.Unlock()
+	return rebuildStyleProfile(owner)
+}
+
+func rebuildStyleProfile(owner string) styleProfile {
+	docs := listDocuments(owner)
+	texts := make([]string, 0, len(docs))
+	for _, d := range docs {
+		texts = append(texts, d.Content)
+	}
+	profile := style.Analyze(texts)
+
+	styleMu.Lock()
+	defer styleMu.Unlock()
+	now := time.Now()
+	p, ok := styleProfiles[owner]
+	if !ok {
+		p = &styleProfile{}
+		styleProfiles[owner] = p
+	}
+	p.Profile = profile
+	p.BuiltAt = now
+	p.UpdatedAt = now
+	return *p
+}
+
+// 用户启用风格档案时，为续写、扩写、生成附加风格要求
+func applyStyleProfile(owner string, req *unifiedAiRequest) {
+	switch req.FunctionType {
+	case "continue", "expand", "generate":
+	default:
+		return
+	}
+	styleMu.Lock()
+	p, ok := styleProfiles[owner]
+	if !ok || !p.Enabled {
+		styleMu.Unlock()
+		return
+	}
+	profile := *p
+	styleMu.Unlock()
+	req.style = formatStyleProfile(profile)
+}
+
+// 把风格档案拼接为提示词中的风格要求
+func formatStyleProfile(p styleProfile) string {
+	var b strings.Builder
+	b.WriteString("写作风格要求（请模仿用户的个人风格）：\n")
+	if p.Metrics.Sentences > 0 {
+		fmt.Fprintf(&b, "- 平均句长约%.0f字，平均段落长度约%.0f字\n", p.Metrics.AvgSentenceLength, p.Metrics.AvgParagraphLength)
+	}
+	if len(p.Tone) > 0 {
+		b.WriteString("- 语气：" + strings.Join(p.Tone, "；") + "\n")
+	}
+	if len(p.Vocabulary) > 0 {
+		b.WriteString("- 常用词：" + strings.Join(p.Vocabulary, "、") + "\n")
+	}
+	if p.Notes != "" {
+		b.WriteString("- 补充说明：" + p.Notes + "\n")
+	}
+	if len(p.Excerpts) > 0 {
+		b.WriteString("风格样例：\n")
+		for _, e := range p.Excerpts {
+			b.WriteString("「" + e + "」\n")
+		}
+	}
+	return b.String()
+}
+
+// 在提示词前附加风格要求
+func withStyle(styleText, prompt string) string {
+	if styleText == "" {
+		return prompt
+	}
+	return styleText + "\n" + prompt
+}
+
+// 去掉空白项
+func compactStrings(items []string) []string {
+	out := make([]string, 0, len(items))
+	for _, s := range items {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"ai-writing-assistant/internal/pkg/ai"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 对话中工具调用的最大轮数
+	maxToolSteps = 5
+	// read_document单次返回的最大字符数
+	readDocumentRunes = 4000
+	// search_documents最多返回的片段数
+	maxSearchResults = 10
+)
+
+var weekdays = []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// 构建当前用户可用的服务端工具，canWrite为false时不提供修改文档的工具
+func newChatTools(owner string, summaries *documentSummarizer, index *documentIndex, canWrite bool) *ai.ToolRegistry {
+	tools := ai.NewToolRegistry()
+
+	tools.Register(ai.ToolDefinition{
+		Name:        "search_documents",
+		Description: "在用户的文档中检索与查询相关的片段，返回文档ID、标题、片段内容和位置",
+		Parameters: objectSchema(map[string]any{
+			"query": stringProp("检索关键词或问题"),
+			"limit": map[string]any{"type": "integer", "description": "最多返回的片段数，默认4"},
+		}, "query"),
+	}, func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var args struct {
+			Query string `json:"query"`
+			Limit int    `json:"limit"`
+		}
+		if err := json.Unmarshal(raw, &args); err != nil || strings.TrimSpace(args.Query) == "" {
+			return nil, errors.New("缺少检索关键词")
+		}
+		if args.Limit <= 0 {
+			args.Limit = index.cfg.TopK
+		}
+		return index.index(owner).Search(ctx, args.Query, min(args.Limit, maxSearchResults)), nil
+	})
+
+	tools.Register(ai.ToolDefinition{
+		Name:        "read_document",
+		Description: "读取用户的一篇文档，内容较长时可通过offset分段读取",
+		Parameters: objectSchema(map[string]any{
+			"documentId": stringProp("文档ID"),
+			"offset":     map[string]any{"type": "integer", "description": "起始字符偏移，默认0"},
+		}, "documentId"),
+	}, func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var args struct {
+			DocumentID string `json:"documentId"`
+			Offset     int    `json:"offset"`
+		}
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, errors.New("无效的参数")
+		}
+		doc, ok := getDocument(owner, args.DocumentID)
+		if !ok {
+			return nil, errors.New("文档不存在")
+		}
+		runes := []rune(doc.Content)
+		start := max(0, min(args.Offset, len(runes)))
+		end := min(start+readDocumentRunes, len(runes))
+		return gin.H{
+			"documentId":  doc.ID,
+			"title":       doc.Title,
+			"totalLength": len(runes),
+			"offset":      start,
+			"content":     string(runes[start:end]),
+			"truncated":   end < len(runes),
+		}, nil
+	})
+
+	if canWrite {
+		tools.Register(ai.ToolDefinition{
+			Name:        "insert_into_document",
+			Description: "在用户文档的指定位置插入文本，未指定位置时追加到末尾",
+			Parameters: objectSchema(map[string]any{
+				"documentId": stringProp("文档ID"),
+				"text":       stringProp("要插入的文本"),
+				"position":   map[string]any{"type": "integer", "description": "插入位置的字符偏移，省略时追加到末尾"},
+			}, "documentId", "text"),
+		}, func(ctx context.Context, raw json.RawMessage) (any, error) {
+			var args struct {
+				DocumentID string `json:"documentId"`
+				Text       string `json:"text"`
+				Position   *int   `json:"position"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil || args.Text == "" {
+				return nil, errors.New("缺少要插入的文本")
+			}
+			pos := -1
+			updated, ok := modifyDocument(owner, args.DocumentID, func(doc *Document) {
+				runes := []rune(doc.Content)
+				pos = len(runes)
+				if args.Position != nil && *args.Position >= 0 && *args.Position < len(runes) {
+					pos = *args.Position
+				}
+				doc.Content = string(runes[:pos]) + args.Text + string(runes[pos:])
+				doc.WordCount = len([]rune(doc.Content))
+			})
+			if !ok {
+				return nil, errors.New("文档不存在")
+			}
+			index.Touch(updated)
+			summaries.Touch(updated)
+			return gin.H{"documentId": updated.ID, "position": pos, "wordCount": updated.WordCount}, nil
+		})
+	}
+
+	tools.Register(ai.ToolDefinition{
+		Name:        "word_count",
+		Description: "统计文本或文档的字数，传入documentId时统计整篇文档",
+		Parameters: objectSchema(map[string]any{
+			"text":       stringProp("要统计的文本"),
+			"documentId": stringProp("要统计的文档ID"),
+		}),
+	}, func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var args struct {
+			Text       string `json:"text"`
+			DocumentID string `json:"documentId"`
+		}
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, errors.New("无效的参数")
+		}
+		if args.DocumentID != "" {
+			doc, ok := getDocument(owner, args.DocumentID)
+			if !ok {
+				return nil, errors.New("文档不存在")
+			}
+			args.Text = doc.Content
+		}
+		return countWords(args.Text), nil
+	})
+
+	tools.Register(ai.ToolDefinition{
+		Name:        "current_date",
+		Description: "获取服务器当前的日期、时间和星期",
+		Parameters:  objectSchema(map[string]any{}),
+	}, func(ctx context.Context, raw json.RawMessage) (any, error) {
+		now := time.Now()
+		zone, _ := now.Zone()
+		return gin.H{
+			"date":     now.Format("2006-01-02"),
+			"time":     now.Format("15:04:05"),
+			"weekday":  weekdays[now.Weekday()],
+			"timezone": zone,
+		}, nil
+	})
+
+	return tools
+}
+
+// 带工具调用的多轮对话，stream为true时通过SSE推送tool_call、tool_result和done事件
+func handleToolChat(c *gin.Context, gens *ai.GenerationRegistry, p ai.Provider, modelName string, req chatRequest, message string, citations []citation, tools *ai.ToolRegistry) {
+	chatter, ok := p.(ai.ToolChatter)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "当前模型不支持工具调用"})
+		return
+	}
+
+	gen, ctx := gens.Start(c.Request.Context(), c.GetString("username"), "chat", modelName)
+	c.Header("X-Generation-ID", gen.ID())
+
+	events := make([]ai.ToolEvent, 0)
+	opts := ai.ToolOptions{MaxSteps: maxToolSteps}
+	if req.Stream {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		opts.OnEvent = func(ev ai.ToolEvent) {
+			c.SSEvent(ev.Type, ev)
+			c.Writer.Flush()
+		}
+	} else {
+		opts.OnEvent = func(ev ai.ToolEvent) { events = append(events, ev) }
+	}
+
+	result, err := chatter.ChatWithTools(ctx, message, req.SessionID, tools, opts)
+	gen.Write([]byte(result))
+	gen.Finish(ctx, err)
+
+	if req.Stream {
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+		} else {
+			c.SSEvent("done", chatResponse{Result: result, ModelName: modelName, GenerationID: gen.ID(), Citations: citations})
+		}
+		c.Writer.Flush()
+		return
+	}
+
+	if err != nil {
+		if writeCancelled(c, ctx, gen) {
+			return
+		}
+		c.JSON(aiErrorStatus(err), gin.H{"error": "AI对话失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, chatResponse{
+		Result:       result,
+		ModelName:    modelName,
+		GenerationID: gen.ID(),
+		Citations:    citations,
+		ToolEvents:   events,
+	})
+}
+
+// 字数统计：字符数不含空白，中日韩文字按字计，其余按词计
+func countWords(text string) gin.H {
+	characters, cjk, words, paragraphs := 0, 0, 0, 0
+	inWord := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			paragraphs++
+		}
+	}
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			characters++
+		}
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			cjk++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return gin.H{
+		"characters":    characters,
+		"cjkCharacters": cjk,
+		"words":         words,
+		"total":         cjk + words,
+		"paragraphs":    paragraphs,
+	}
+}
+
+func objectSchema(props map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringProp(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
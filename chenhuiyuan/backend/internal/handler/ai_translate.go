@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ai-writing-assistant/internal/pkg/langdetect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 术语表条目，翻译时强制使用Target作为Source的译法
+type glossaryTerm struct {
+	ID             int    `json:"id"`
+	Source         string `json:"source"`
+	Target         string `json:"target"`
+	TargetLanguage string `json:"targetLanguage,omitempty"` // 为空时对所有目标语言生效
+}
+
+// 译文的术语校验结果
+type glossaryCheck struct {
+	Applied []glossaryTerm `json:"applied"`
+	Missing []glossaryTerm `json:"missing"`
+}
+
+// 翻译响应
+type translateResponse struct {
+	unifiedAiResponse
+	SourceLanguage string        `json:"sourceLanguage"`
+	TargetLanguage string        `json:"targetLanguage"`
+	Glossary       glossaryCheck `json:"glossary"`
+}
+
+// 按用户名保存的术语表
+var (
+	glossaryMu  sync.Mutex
+	glossaries  = make(map[string][]glossaryTerm)
+	glossarySeq int
+)
+
+func registerGlossaryRoutes(g *gin.RouterGroup) {
+	g.GET("/ai/glossary", func(c *gin.Context) {
+		glossaryMu.Lock()
+		defer glossaryMu.Unlock()
+		list := append([]glossaryTerm{}, glossaries[c.GetString("username")]...)
+		c.JSON(http.StatusOK, list)
+	})
+
+	// 新增术语，相同原文和目标语言的条目会被覆盖
+	g.POST("/ai/glossary", func(c *gin.Context) {
+		var req glossaryTerm
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		req.Source = strings.TrimSpace(req.Source)
+		req.Target = strings.TrimSpace(req.Target)
+		req.TargetLanguage = strings.ToLower(strings.TrimSpace(req.TargetLanguage))
+		if req.Source == "" || req.Target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "原文和译文不能为空"})
+			return
+		}
+
+		username := c.GetString("username")
+		glossaryMu.Lock()
+		defer glossaryMu.Unlock()
+		terms := glossaries[username]
+		for i, t := range terms {
+			if strings.EqualFold(t.Source, req.Source) && t.TargetLanguage == req.TargetLanguage {
+				req.ID = t.ID
+				terms[i] = req
+				c.JSON(http.StatusOK, req)
+				return
+			}
+		}
+		glossarySeq++
+		req.ID = glossarySeq
+		glossaries[username] = append(terms, req)
+		c.JSON(http.StatusOK, req)
+	})
+
+	g.DELETE("/ai/glossary/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的术语ID"})
+			return
+		}
+		username := c.GetString("username")
+		glossaryMu.Lock()
+		defer glossaryMu.Unlock()
+		terms := glossaries[username]
+		for i, t := range terms {
+			if t.ID == id {
+				glossaries[username] = append(terms[:i:i], terms[i+1:]...)
+				break
+			}
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// 补全翻译参数：识别源语言、默认目标语言，并找出原文中出现的术语
+func prepareTranslate(req *unifiedAiRequest, username string) {
+	if req.FunctionType != "translate" {
+		return
+	}
+	req.SourceLanguage = strings.ToLower(strings.TrimSpace(req.SourceLanguage))
+	req.TargetLanguage = strings.ToLower(strings.TrimSpace(req.TargetLanguage))
+	if req.SourceLanguage == "" || req.SourceLanguage == "auto" {
+		req.SourceLanguage = langdetect.Detect(req.SelectedText)
+	}
+	if req.TargetLanguage == "" {
+		// 未指定目标语言时中译英，其余语言译为中文
+		if req.SourceLanguage == "zh" {
+			req.TargetLanguage = "en"
+		} else {
+			req.TargetLanguage = "zh"
+		}
+	}
+
+	glossaryMu.Lock()
+	defer glossaryMu.Unlock()
+	req.glossary = nil
+	for _, t := range glossaries[username] {
+		if t.TargetLanguage != "" && t.TargetLanguage != req.TargetLanguage {
+			continue
+		}
+		if containsFold(req.SelectedText, t.Source) {
+			req.glossary = append(req.glossary, t)
+		}
+	}
+}
+
+// 构建翻译提示词
+func buildTranslatePrompt(req unifiedAiRequest) string {
+	var b strings.Builder
+	if req.UserRequirement != "" {
+		b.WriteString("翻译要求：" + req.UserRequirement + "\n\n")
+	}
+	source := "自动识别"
+	if req.SourceLanguage != "" {
+		source = langdetect.Name(req.SourceLanguage)
+	}
+	b.WriteString("源语言：" + source + "\n")
+	b.WriteString("目标语言：" + langdetect.Name(req.TargetLanguage) + "\n")
+	switch req.Register {
+	case "formal":
+		b.WriteString("语体：正式、书面，使用敬语或正式称谓\n")
+	case "informal":
+		b.WriteString("语体：口语化、轻松自然\n")
+	}
+	if len(req.glossary) > 0 {
+		b.WriteString("\n必须使用以下术语译法（原文 => 译文）：\n")
+		for _, t := range req.glossary {
+			b.WriteString("- " + t.Source + " => " + t.Target + "\n")
+		}
+	}
+	if req.PreserveMarkdown {
+		b.WriteString("\n原文为Markdown：保留标题、列表、表格、链接和强调等标记，链接地址、代码块和行内代码保持原样不翻译。\n")
+	}
+	b.WriteString("\n原文：" + req.SelectedText + "\n\n")
+	b.WriteString("请直接输出译文，不要添加解释。")
+	return b.String()
+}
+
+// 检查译文是否使用了术语表规定的译法
+func checkGlossary(output string, terms []glossaryTerm) glossaryCheck {
+	check := glossaryCheck{Applied: []glossaryTerm{}, Missing: []glossaryTerm{}}
+	for _, t := range terms {
+		if containsFold(output, t.Target) {
+			check.Applied = append(check.Applied, t)
+		} else {
+			check.Missing = append(check.Missing, t)
+		}
+	}
+	return check
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +10,7 @@ import (
 
 type Document struct {
 	ID        string    `json:"id"`
+	Owner     string    `json:"-"`
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"createdAt"`
@@ -16,15 +18,51 @@ type Document struct {
 	WordCount int       `json:"wordCount"`
 }
 
-var inMemoryDocs = make(map[string]*Document)
+var (
+	docsMu       sync.RWMutex
+	inMemoryDocs = make(map[string]*Document)
+)
 
-func registerDocumentRoutes(g *gin.RouterGroup) {
-	g.GET("/documents", func(c *gin.Context) {
-		list := make([]*Document, 0, len(inMemoryDocs))
-		for _, d := range inMemoryDocs {
-			list = append(list, d)
+// 获取属于owner的文档副本
+func getDocument(owner, id string) (Document, bool) {
+	docsMu.RLock()
+	defer docsMu.RUnlock()
+	doc, ok := inMemoryDocs[id]
+	if !ok || doc.Owner != owner {
+		return Document{}, false
+	}
+	return *doc, true
+}
+
+// 列出owner的全部文档副本
+func listDocuments(owner string) []Document {
+	docsMu.RLock()
+	defer docsMu.RUnlock()
+	list := make([]Document, 0)
+	for _, d := range inMemoryDocs {
+		if d.Owner == owner {
+			list = append(list, *d)
 		}
-		c.JSON(http.StatusOK, list)
+	}
+	return list
+}
+
+// 在锁内修改属于owner的文档，返回修改后的副本
+func modifyDocument(owner, id string, fn func(doc *Document)) (Document, bool) {
+	docsMu.Lock()
+	defer docsMu.Unlock()
+	doc, ok := inMemoryDocs[id]
+	if !ok || doc.Owner != owner {
+		return Document{}, false
+	}
+	fn(doc)
+	doc.UpdatedAt = time.Now()
+	return *doc, true
+}
+
+func registerDocumentRoutes(g *gin.RouterGroup, summaries *documentSummarizer, index *documentIndex) {
+	g.GET("/documents", func(c *gin.Context) {
+		c.JSON(http.StatusOK, listDocuments(c.GetString("username")))
 	})
 
 	type createReq struct {
@@ -40,13 +78,16 @@ func registerDocumentRoutes(g *gin.RouterGroup) {
 		id := now.Format("20060102150405.000000000")
 		doc := &Document{
 			ID:        id,
+			Owner:     c.GetString("username"),
 			Title:     req.Title,
 			Content:   "",
 			CreatedAt: now,
 			UpdatedAt: now,
 			WordCount: 0,
 		}
+		docsMu.Lock()
 		inMemoryDocs[id] = doc
+		docsMu.Unlock()
 		c.JSON(http.StatusOK, doc)
 	})
 
@@ -55,31 +96,41 @@ func registerDocumentRoutes(g *gin.RouterGroup) {
 		Title   string `json:"title"`
 	}
 	g.PUT("/documents/:id", func(c *gin.Context) {
-		id := c.Param("id")
-		doc, ok := inMemoryDocs[id]
-		if !ok {
-			c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
-			return
-		}
 		var req updateReq
 		if err := c.BindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
 			return
 		}
-		if req.Title != "" {
-			doc.Title = req.Title
-		}
-		if req.Content != "" {
-			doc.Content = req.Content
-			doc.WordCount = len([]rune(req.Content))
+
+		updated, ok := modifyDocument(c.GetString("username"), c.Param("id"), func(doc *Document) {
+			if req.Title != "" {
+				doc.Title = req.Title
+			}
+			if req.Content != "" {
+				doc.Content = req.Content
+				doc.WordCount = len([]rune(req.Content))
+			}
+		})
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+			return
 		}
-		doc.UpdatedAt = time.Now()
-		c.JSON(http.StatusOK, doc)
+
+		// 内容变化后更新检索索引，并在后台更新文档摘要
+		index.Touch(updated)
+		summaries.Touch(updated)
+		c.JSON(http.StatusOK, updated)
 	})
 
 	g.DELETE("/documents/:id", func(c *gin.Context) {
 		id := c.Param("id")
-		delete(inMemoryDocs, id)
+		docsMu.Lock()
+		if doc, ok := inMemoryDocs[id]; ok && doc.Owner == c.GetString("username") {
+			delete(inMemoryDocs, id)
+			summaries.Forget(id)
+			index.Forget(doc.Owner, id)
+		}
+		docsMu.Unlock()
 		c.Status(http.StatusNoContent)
 	})
 }
@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 不超过该长度的文档直接以全文作为摘要
+	shortDocumentRunes = 300
+	// 停止编辑多久后重新生成摘要
+	summaryDebounce = 30 * time.Second
+	// 生成摘要时送入模型的最大token数
+	summaryInputTokens = 3000
+	// 上下文窗口的最小token预算
+	minContextTokens = 200
+)
+
+// 摘要缓存命中情况：hit为摘要与当前内容一致，stale为返回旧摘要，miss为退化为抽取式摘要
+var summaryCacheRequests = metrics.NewCounterVec("ai_cache_requests_total",
+	"缓存查询次数，result为hit、stale或miss", "cache", "result")
+
+// 句子结束符，用于上下文窗口对齐句子边界
+const sentenceEnds = "。！？.!?\n"
+
+// 文档摘要
+type docSummary struct {
+	summary   string
+	hash      string
+	updatedAt time.Time
+}
+
+// 在后台维护文档摘要：文档更新后延迟生成，AI请求时发现摘要过期也会触发更新
+type documentSummarizer struct {
+	svc     *ai.Service
+	mu      sync.Mutex
+	items   map[string]docSummary
+	timers  map[string]*time.Timer
+	running map[string]uint64 // 文档ID -> 进行中的生成编号，文档删除后清除
+	runs    uint64
+}
+
+func newDocumentSummarizer(svc *ai.Service) *documentSummarizer {
+	return &documentSummarizer{
+		svc:     svc,
+		items:   make(map[string]docSummary),
+		timers:  make(map[string]*time.Timer),
+		running: make(map[string]uint64),
+	}
+}
+
+// 文档内容变化时调用，停止编辑一段时间后重新生成摘要
+func (s *documentSummarizer) Touch(doc Document) {
+	s.schedule(doc.Owner, doc.ID, summaryDebounce)
+}
+
+// 文档删除时清理摘要
+func (s *documentSummarizer) Forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[id]; ok {
+		t.Stop()
+		delete(s.timers, id)
+	}
+	delete(s.items, id)
+	delete(s.running, id)
+}
+
+// 获取文档摘要：摘要与当前内容一致时直接返回，否则返回旧摘要或抽取式摘要并在后台更新
+func (s *documentSummarizer) Summary(doc Document) string {
+	if len([]rune(doc.Content)) <= shortDocumentRunes {
+		return doc.Content
+	}
+
+	s.mu.Lock()
+	item, ok := s.items[doc.ID]
+	_, pending := s.timers[doc.ID]
+	s.mu.Unlock()
+	if ok && item.hash == contentHash(doc.Content) {
+		summaryCacheRequests.Inc("document_summary", "hit")
+		return item.summary
+	}
+	if !pending {
+		s.schedule(doc.Owner, doc.ID, 0)
+	}
+	if ok {
+		summaryCacheRequests.Inc("document_summary", "stale")
+		return item.summary
+	}
+	summaryCacheRequests.Inc("document_summary", "miss")
+	return extractiveSummary(doc.Content)
+}
+
+func (s *documentSummarizer) schedule(owner, id string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[id]; ok {
+		t.Stop()
+	}
+	s.timers[id] = time.AfterFunc(delay, func() { s.refresh(owner, id) })
+}
+
+func (s *documentSummarizer) refresh(owner, id string) {
+	s.mu.Lock()
+	delete(s.timers, id)
+	if _, ok := s.running[id]; ok {
+		s.mu.Unlock()
+		return
+	}
+	s.runs++
+	run := s.runs
+	s.running[id] = run
+	item, hasItem := s.items[id]
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.running[id] == run {
+			delete(s.running, id)
+		}
+		s.mu.Unlock()
+	}()
+
+	doc, ok := getDocument(owner, id)
+	if !ok {
+		return
+	}
+	hash := contentHash(doc.Content)
+	if hasItem && item.hash == hash {
+		return
+	}
+
+	summary := doc.Content
+	if len([]rune(doc.Content)) > shortDocumentRunes {
+		p := s.svc.CurrentProvider()
+		if p == nil || !p.IsAvailable() {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		prompt := buildSummarizePrompt("概括全文的主题、结构和主要观点，不超过200字", truncateMiddle(doc.Content, summaryInputTokens))
+		result, err := p.SummarizeText(ctx, prompt)
+		if err != nil {
+			slog.Warn("生成文档摘要失败", "doc", id, logging.Err(err))
+			return
+		}
+		summary = strings.TrimSpace(result)
+	}
+
+	// 生成期间文档被删除时丢弃结果，否则摘要会一直留在缓存中
+	s.mu.Lock()
+	if s.running[id] == run {
+		s.items[id] = docSummary{summary: summary, hash: hash, updatedAt: time.Now()}
+	}
+	s.mu.Unlock()
+}
+
+// 请求携带documentId时，由服务端根据已保存的文档补全选中文本、上下文和文档摘要；
+// 出错时已写出响应并返回false
+func bindDocumentContext(c *gin.Context, req *unifiedAiRequest, p ai.Provider, summaries *documentSummarizer) bool {
+	if req.DocumentID == "" {
+		return true
+	}
+	if !requireDocumentScope(c, account.ScopeDocumentsRead) {
+		return false
+	}
+	doc, ok := getDocument(c.GetString("username"), req.DocumentID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+		return false
+	}
+
+	runes := []rune(doc.Content)
+	start, end := req.CursorPosition, req.CursorPosition
+	if req.SelectionStart != nil {
+		start = *req.SelectionStart
+		end = start
+	}
+	if req.SelectionEnd != nil {
+		end = *req.SelectionEnd
+	}
+	if start < 0 || end < start || end > len(runes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "选区超出文档范围"})
+		return false
+	}
+
+	if start < end {
+		req.SelectedText = string(runes[start:end])
+	}
+	req.DocumentSummary = summaries.Summary(doc)
+
+	// 上下文预算为模型上限的一半，扣除摘要、选中文本和要求占用的部分
+	budget := 4000
+	if p != nil {
+		budget = p.GetModelInfo().MaxTokens
+	}
+	budget = budget/2 - ai.EstimateTokens(req.DocumentSummary) - ai.EstimateTokens(req.SelectedText) - ai.EstimateTokens(req.UserRequirement)
+	if budget < minContextTokens {
+		budget = minContextTokens
+	}
+	before, after := contextWindow(runes, start, end, float64(budget))
+	req.ContextText = string(runes[before:after])
+	return true
+}
+
+// 以选区为中心在预算内扩展上下文窗口，前文占2/3、后文占1/3，
+// 一侧用不完的预算让给另一侧，并尽量对齐到句子边界
+func contextWindow(runes []rune, start, end int, budget float64) (int, int) {
+	for i := start; i < end; i++ {
+		budget -= ai.TokenWeight(runes[i])
+	}
+
+	before, after := start, end
+	beforeBudget := budget * 2 / 3
+	for before > 0 && beforeBudget >= ai.TokenWeight(runes[before-1]) {
+		before--
+		beforeBudget -= ai.TokenWeight(runes[before])
+	}
+	afterBudget := budget/3 + beforeBudget
+	for after < len(runes) && afterBudget >= ai.TokenWeight(runes[after]) {
+		afterBudget -= ai.TokenWeight(runes[after])
+		after++
+	}
+	for before > 0 && afterBudget >= ai.TokenWeight(runes[before-1]) {
+		before--
+		afterBudget -= ai.TokenWeight(runes[before])
+	}
+
+	// 窗口被截断时，去掉首尾不完整的句子
+	if before > 0 {
+		for i := before; i < start; i++ {
+			if strings.ContainsRune(sentenceEnds, runes[i]) {
+				before = i + 1
+				break
+			}
+		}
+	}
+	if after < len(runes) {
+		for i := after - 1; i >= end; i-- {
+			if strings.ContainsRune(sentenceEnds, runes[i]) {
+				after = i + 1
+				break
+			}
+		}
+	}
+	return before, after
+}
+
+// 抽取式摘要：取开头和结尾各100字，在模型摘要生成前临时使用
+func extractiveSummary(content string) string {
+	runes := []rune(content)
+	if len(runes) <= 200 {
+		return content
+	}
+	return string(runes[:100]) + "..." + string(runes[len(runes)-100:])
+}
+
+// 超出token预算时保留开头2/3和结尾1/3
+func truncateMiddle(content string, maxTokens int) string {
+	if ai.EstimateTokens(content) <= maxTokens {
+		return content
+	}
+	runes := []rune(content)
+	head, budget := 0, float64(maxTokens)*2/3
+	for head < len(runes) && budget >= ai.TokenWeight(runes[head]) {
+		budget -= ai.TokenWeight(runes[head])
+		head++
+	}
+	tail, budget := len(runes), float64(maxTokens)/3
+	for tail > head && budget >= ai.TokenWeight(runes[tail-1]) {
+		tail--
+		budget -= ai.TokenWeight(runes[tail])
+	}
+	return string(runes[:head]) + "\n……\n" + string(runes[tail:])
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 注册Prometheus指标接口，配置了metrics.token时需要携带该令牌
+func registerMetricsRoute(r *gin.Engine, manager *ai.ConfigManager) {
+	if !manager.Current().Metrics.Enabled {
+		return
+	}
+	warnMetricsToken(manager.Current().Metrics)
+	manager.OnChange(func(old, cfg *ai.AIConfig) {
+		if old.Metrics.Token != "" {
+			warnMetricsToken(cfg.Metrics)
+		}
+	})
+	handler := metrics.Default.Handler()
+	r.GET("/metrics", func(c *gin.Context) {
+		token := manager.Current().Metrics.Token
+		if token != "" {
+			// 必须是完整的"Bearer <token>"，只给出令牌本身不算
+			want := "Bearer " + token
+			if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte(want)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的指标令牌"})
+				return
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+// 未配置令牌时任何人都能抓取指标，其中包含模型名称和调用量
+func warnMetricsToken(cfg ai.MetricsConfig) {
+	if cfg.Token == "" {
+		slog.Warn("/metrics未配置metrics.token，无需认证即可访问，生产环境请配置令牌或关闭metrics.enabled")
+	}
+}
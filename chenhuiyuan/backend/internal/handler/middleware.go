@@ -1,27 +1,164 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/metrics"
+	"ai-writing-assistant/internal/pkg/moderation"
+	"ai-writing-assistant/internal/pkg/secrets"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func useMiddlewares(r *gin.Engine) {
-	r.Use(gin.Logger())
+	r.Use(requestID())
+	r.Use(accessLog())
+	r.Use(recordMetrics())
 	r.Use(gin.Recovery())
+	r.Use(redactSecrets())
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Generation-ID", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 }
 
-// auth middleware
-func requireAuth() gin.HandlerFunc {
+// 客户端或网关传入的请求ID只接受这些字符，防止伪造日志内容
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// 为每个请求分配请求ID（沿用合法的X-Request-ID请求头），写入响应头和日志context，
+// 调用模型提供者时也会转发
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Header("X-Request-ID", id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// 访问日志，用户和请求ID来自请求context。只记录路径，查询参数中可能有授权码等敏感内容
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+			slog.String("ip", c.ClientIP()),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "请求", attrs...)
+	}
+}
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total",
+		"HTTP请求数，route为路由模板，未匹配的路由为unmatched", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"HTTP请求处理耗时，流式接口到输出结束", metrics.DefaultBuckets, "method", "route")
+)
+
+// 按路由模板（如/api/documents/:id）统计请求数和耗时，避免路径参数产生过多序列
+func recordMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.Inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+		httpDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route)
+	}
+}
+
+// 记录当前请求的用户，之后的日志都会带上user字段
+func setRequestUser(c *gin.Context, username string) {
+	c.Set("username", username)
+	c.Request = c.Request.WithContext(logging.WithAttrs(c.Request.Context(), slog.String("user", username)))
+}
+
+// 安全事件日志，带category=security字段以便单独检索和告警
+func securityLog(ctx context.Context, level slog.Level, msg string, args ...any) {
+	slog.Log(ctx, level, msg, append([]any{"category", "security"}, args...)...)
+}
+
+// 隐藏响应中出现的密钥值（如模型接口在错误信息中回显的API密钥）
+func redactSecrets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &secretRedactingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		w.writePending()
+	}
+}
+
+// 流式响应中密钥值可能被拆到两次写入中，末尾可能是密钥开头的部分暂不写出，
+// 和后续内容一起替换，请求结束时再写出剩余部分
+type secretRedactingWriter struct {
+	gin.ResponseWriter
+	pending string // 已替换、尚未写出的末尾部分
+}
+
+func (w *secretRedactingWriter) Write(p []byte) (int, error) {
+	return w.WriteString(string(p))
+}
+
+func (w *secretRedactingWriter) WriteString(s string) (int, error) {
+	out := secrets.Redact(w.pending + s)
+	n := len(out) - secrets.PartialLen(out)
+	w.pending = out[n:]
+	if n > 0 {
+		if _, err := w.ResponseWriter.WriteString(out[:n]); err != nil {
+			return 0, err
+		}
+	}
+	return len(s), nil
+}
+
+func (w *secretRedactingWriter) writePending() {
+	if w.pending != "" {
+		w.ResponseWriter.WriteString(w.pending)
+		w.pending = ""
+	}
+}
+
+// auth middleware，接受登录会话的JWT和个人访问令牌
+func requireAuth(users account.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -42,12 +179,116 @@ func requireAuth() gin.HandlerFunc {
 			return
 		}
 
-		username, err := parseJWT(token)
-		if err != nil || username == "" {
+		if strings.HasPrefix(token, personalTokenPrefix) {
+			t, u, err := authenticatePersonalToken(c.Request.Context(), users, token, c.ClientIP())
+			if errors.Is(err, errPersonalTokenInvalid) {
+				c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(500, gin.H{"error": "校验令牌失败"})
+				return
+			}
+			setRequestUser(c, u.Username)
+			c.Set("tokenScopes", t.Scopes)
+			c.Next()
+			return
+		}
+
+		claims, err := parseAccessToken(c.Request.Context(), users, token)
+		if errors.Is(err, errTokenCheck) {
+			c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
 			c.AbortWithStatusJSON(401, gin.H{"error": "无效的认证令牌"})
 			return
 		}
-		c.Set("username", username)
+		setRequestUser(c, claims.Subject)
+		c.Set("tokenClaims", claims)
+		c.Next()
+	}
+}
+
+// 只允许登录会话调用，拒绝个人访问令牌（修改密码、管理令牌、管理接口等）
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("tokenClaims"); !ok {
+			c.AbortWithStatusJSON(403, gin.H{"error": "该接口不支持个人访问令牌，请登录后调用"})
+			return
+		}
+	}
+}
+
+// 个人访问令牌需要具有指定权限范围，登录会话不受限制。
+// write为空时所有请求都需要read，否则GET/HEAD需要read，其余请求需要write
+func requireScope(read, write string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := read
+		if write != "" && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			scope = write
+		}
+		if !hasScope(c, scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "令牌缺少权限范围: " + scope})
+			return
+		}
+	}
+}
+
+// 当前请求是否具有权限范围，登录会话具有全部权限
+func hasScope(c *gin.Context, scope string) bool {
+	v, ok := c.Get("tokenScopes")
+	return !ok || slices.Contains(v.([]string), scope)
+}
+
+// AI接口读写文档（documentId、检索、工具）时额外检查文档权限，出错时已写出响应并返回false
+func requireDocumentScope(c *gin.Context, scope string) bool {
+	if hasScope(c, scope) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "令牌缺少权限范围: " + scope})
+	return false
+}
+
+// 要求当前用户具有指定角色之一，需在requireAuth之后使用。
+// 角色每次从用户存储读取，管理员修改后立即生效
+func requireRole(users account.UserStore, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := users.GetByUsername(c.Request.Context(), c.GetString("username"))
+		if errors.Is(err, account.ErrUserNotFound) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "用户不存在"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"error": "读取用户失败"})
+			return
+		}
+		if !slices.Contains(roles, u.Role) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "权限不足"})
+			return
+		}
+		c.Set("role", u.Role)
+	}
+}
+
+// 查看者只能发起GET请求，其余请求需要编辑者或管理员
+func requireWriteRole(users account.UserStore) gin.HandlerFunc {
+	read := requireRole(users, account.RoleAdmin, account.RoleEditor, account.RoleViewer)
+	write := requireRole(users, account.RoleAdmin, account.RoleEditor)
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			read(c)
+		} else {
+			write(c)
+		}
+	}
+}
+
+// 在请求context上标记当前用户，供内容审核写入审计日志
+func withAuditSubject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := moderation.WithSubject(c.Request.Context(), c.GetString("username"))
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"ai-writing-assistant/internal/pkg/moderation"
+
+	"github.com/gin-gonic/gin"
+)
+
+func registerModerationRoutes(g *gin.RouterGroup, audit *moderation.AuditLog) {
+	// 当前用户请求的敏感内容命中记录
+	g.GET("/ai/moderation/audit", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		c.JSON(http.StatusOK, audit.Entries(c.GetString("username"), limit))
+	})
+}
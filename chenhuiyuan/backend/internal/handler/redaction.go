@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"ai-writing-assistant/internal/pkg/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 脱敏策略编辑请求
+type redactionPolicyRequest struct {
+	Enabled   bool                `json:"enabled"`
+	Types     []string            `json:"types"`
+	Functions map[string][]string `json:"functions"`
+	Names     []string            `json:"names"`
+}
+
+// 脱敏策略响应，custom表示用户是否自定义过
+type redactionPolicyResponse struct {
+	redact.Policy
+	Custom bool `json:"custom"`
+}
+
+var (
+	redactionMu       sync.Mutex
+	redactionPolicies = make(map[string]redact.Policy)
+	redactionDefaults redact.Policy // 来自配置的默认策略，重新加载配置时更新
+)
+
+// 更新默认脱敏策略
+func setRedactionDefaults(p redact.Policy) {
+	redactionMu.Lock()
+	defer redactionMu.Unlock()
+	redactionDefaults = p
+}
+
+func registerRedactionRoutes(g *gin.RouterGroup) {
+	// 获取当前用户的脱敏策略
+	g.GET("/ai/redaction/policy", func(c *gin.Context) {
+		policy, custom := userRedactionPolicy(c.GetString("username"))
+		c.JSON(http.StatusOK, redactionPolicyResponse{Policy: policy, Custom: custom})
+	})
+
+	// 自定义脱敏策略
+	g.PUT("/ai/redaction/policy", func(c *gin.Context) {
+		var req redactionPolicyRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+
+		policy := redact.Policy{Enabled: req.Enabled, Functions: make(map[string][]redact.Type), Names: compactStrings(req.Names)}
+		var err error
+		if policy.Types, err = redact.ParseTypes(req.Types); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for function, types := range req.Functions {
+			if policy.Functions[strings.TrimSpace(function)], err = redact.ParseTypes(types); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		redactionMu.Lock()
+		redactionPolicies[c.GetString("username")] = policy
+		redactionMu.Unlock()
+		c.JSON(http.StatusOK, redactionPolicyResponse{Policy: policy, Custom: true})
+	})
+
+	// 恢复为默认策略
+	g.DELETE("/ai/redaction/policy", func(c *gin.Context) {
+		redactionMu.Lock()
+		delete(redactionPolicies, c.GetString("username"))
+		defaults := redactionDefaults
+		redactionMu.Unlock()
+		c.JSON(http.StatusOK, redactionPolicyResponse{Policy: defaults})
+	})
+
+	// 预览文本脱敏后发送给模型的内容
+	g.POST("/ai/redaction/preview", func(c *gin.Context) {
+		var req struct {
+			Text     string `json:"text"`
+			Function string `json:"function"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		policy, _ := userRedactionPolicy(c.GetString("username"))
+		types, names := policy.For(req.Function)
+		c.JSON(http.StatusOK, gin.H{
+			"text":  redact.NewVault().Redact(req.Text, types, names),
+			"spans": redact.Detect(req.Text, types, names),
+		})
+	})
+}
+
+// 用户的脱敏策略，未自定义时返回默认策略
+func userRedactionPolicy(owner string) (redact.Policy, bool) {
+	redactionMu.Lock()
+	defer redactionMu.Unlock()
+	if p, ok := redactionPolicies[owner]; ok {
+		return p, true
+	}
+	return redactionDefaults, false
+}
+
+// 在请求context上挂载当前用户及其脱敏策略，供调用第三方模型前脱敏
+func withRedactionPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+		policy, _ := userRedactionPolicy(username)
+		ctx := redact.WithOwner(c.Request.Context(), username)
+		c.Request = c.Request.WithContext(redact.WithPolicy(ctx, policy))
+		c.Next()
+	}
+}
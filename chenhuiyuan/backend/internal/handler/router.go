@@ -1,22 +1,95 @@
 package handler
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/moderation"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter() http.Handler {
+// 创建路由和后台任务。返回的shutdown在HTTP服务停止后调用，
+// 停止配置监视和健康探测，并在ctx结束前等待异步任务完成
+func NewRouter() (http.Handler, func(ctx context.Context)) {
+	manager := ai.DefaultConfigManager()
+	config := manager.Current()
+
 	r := gin.New()
+	// 登录失败按来源IP计数，只接受可信代理转发的客户端地址
+	if err := r.SetTrustedProxies(config.Server.TrustedProxies); err != nil {
+		logging.Fatal("server.trusted_proxies配置有误", logging.Err(err))
+	}
 	useMiddlewares(r)
+	if err := configureAuth(manager); err != nil {
+		logging.Fatal("登录令牌配置有误", logging.Err(err))
+	}
+	if err := configureOIDC(manager); err != nil {
+		logging.Fatal("单点登录配置有误", logging.Err(err))
+	}
+	users, err := account.Open(config.Database.Driver, config.Database.DSN)
+	if err != nil {
+		logging.Fatal("打开用户存储失败", logging.Err(err))
+	}
+	if err := ensureInitialAdmin(context.Background(), users, config.Auth.InitialAdmin); err != nil {
+		logging.Fatal("创建初始管理员失败", logging.Err(err))
+	}
+
+	audit := moderation.NewAuditLog(1000)
+	svc, err := newAIService(manager, audit)
+	if err != nil {
+		logging.Fatal("创建AI服务失败", logging.Err(err))
+	}
+
+	// 进行中的生成任务结束后保留10分钟以便查询部分输出
+	data := &userData{
+		jobs:      ai.NewJobQueue(svc, config.AI.Jobs),
+		gens:      ai.NewGenerationRegistry(10 * time.Minute),
+		summaries: newDocumentSummarizer(svc),
+		index:     newDocumentIndex(config.AI.Retrieval),
+	}
 
 	api := r.Group("/api")
-	registerUserRoutes(api)
+	registerUserRoutes(api, users, data)
+	registerOIDCRoutes(api, users)
+
 	protected := api.Group("")
-	protected.Use(requireAuth())
-	registerDocumentRoutes(protected)
-	registerAIRoutes(protected)
+	protected.Use(requireAuth(users), requireWriteRole(users), withAuditSubject(), withRedactionPolicy())
+	// 个人访问令牌按权限范围限制可调用的接口
+	docs := protected.Group("", requireScope(account.ScopeDocumentsRead, account.ScopeDocumentsWrite))
+	aiGroup := protected.Group("", requireScope(account.ScopeAIInvoke, ""))
+
+	registerDocumentRoutes(docs, data.summaries, data.index)
+	registerAIRoutes(aiGroup, svc, data.jobs, data.gens, data.summaries, data.index)
+	registerModerationRoutes(aiGroup, audit)
+	registerRedactionRoutes(aiGroup)
+
+	// 全局设置和用户管理仅限管理员
+	admin := api.Group("/admin")
+	admin.Use(requireAuth(users), requireSession(), requireRole(users, account.RoleAdmin))
+	registerAdminRoutes(admin, users, data, svc, manager, audit)
+
+	// 监视配置文件，修改后或收到SIGHUP时重新加载
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	manager.Watch(watchCtx, 2*time.Second)
 
 	r.GET("/health", func(c *gin.Context) { c.String(200, "ok") })
-	return r
+	registerMetricsRoute(r, manager)
+
+	shutdown := func(ctx context.Context) {
+		stopWatch()
+		svc.StopHealthChecks()
+		if err := data.jobs.Shutdown(ctx); err != nil {
+			slog.Warn("等待异步任务完成超时，已取消剩余任务", logging.Err(err))
+		}
+		if err := users.Close(); err != nil {
+			slog.Error("关闭用户存储失败", logging.Err(err))
+		}
+	}
+	return r, shutdown
 }
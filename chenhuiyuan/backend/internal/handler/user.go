@@ -1,22 +1,30 @@
 package handler
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
 
+	"ai-writing-assistant/internal/pkg/account"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type user struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Password string `json:"-"`
-}
+// 没有本地密码的账号执行敏感操作前，会话须在该时间内登录
+const reauthWindow = 5 * time.Minute
 
-var users = map[string]*user{}
+// 资料修改请求，未提供的字段保持不变
+type updateProfileRequest struct {
+	DisplayName *string `json:"displayName"`
+	Email       *string `json:"email"`
+}
 
-func registerUserRoutes(g *gin.RouterGroup) {
+func registerUserRoutes(g *gin.RouterGroup, users account.UserStore, data *userData) {
 	g.POST("/auth/register", func(c *gin.Context) {
 		var req struct {
 			Username string `json:"username"`
@@ -26,8 +34,8 @@ func registerUserRoutes(g *gin.RouterGroup) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
 			return
 		}
-		if _, ok := users[req.Username]; ok {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "用户已存在"})
+		if err := account.CheckPassword(currentPasswordPolicy(), req.Username, req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -35,11 +43,19 @@ func registerUserRoutes(g *gin.RouterGroup) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
 			return
 		}
-		u := &user{ID: time.Now().Format("20060102150405"), Username: req.Username, Password: string(hash)}
-		users[req.Username] = u
-		c.JSON(http.StatusOK, gin.H{"message": "注册成功"})
+		u := &account.User{ID: uuid.NewString(), Username: req.Username, PasswordHash: string(hash)}
+		if err := users.Create(c.Request.Context(), u); err != nil {
+			if errors.Is(err, account.ErrUsernameTaken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "用户已存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "注册成功", "user": u})
 	})
 
+	// 登录失败按账号和来源IP计数，超过次数后需要等待，达到阈值后临时锁定
 	g.POST("/auth/login", func(c *gin.Context) {
 		var req struct {
 			Username string `json:"username"`
@@ -49,16 +65,245 @@ func registerUserRoutes(g *gin.RouterGroup) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
 			return
 		}
-		u, ok := users[req.Username]
-		if !ok || bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)) != nil {
+		ip := c.ClientIP()
+		if wait, locked := reserveLoginAttempt(req.Username, ip); wait > 0 {
+			writeLoginThrottled(c, wait, locked)
+			return
+		}
+		u, err := users.GetByUsername(c.Request.Context(), req.Username)
+		if err != nil && !errors.Is(err, account.ErrUserNotFound) {
+			releaseLoginAttempt(req.Username, ip)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		if u == nil || bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+			recordLoginFailure(c.Request.Context(), req.Username, ip)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 			return
 		}
-		token, err := issueJWT(u.Username)
+		recordLoginSuccess(u.Username, ip)
+		tokens, err := newSession(c.Request.Context(), users, u.Username)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"token": token, "message": "登录成功"})
+		c.JSON(http.StatusOK, gin.H{
+			"token":        tokens.AccessToken,
+			"refreshToken": tokens.RefreshToken,
+			"expiresIn":    tokens.ExpiresIn,
+			"message":      "登录成功",
+		})
+	})
+
+	// 用刷新令牌换取新的访问令牌和刷新令牌，旧刷新令牌随即失效
+	g.POST("/auth/refresh", func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		tokens, username, err := refreshSession(c.Request.Context(), users, req.RefreshToken)
+		if errors.Is(err, errRefreshInvalid) || errors.Is(err, errRefreshReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+			return
+		}
+		// 账号已删除时不再续期
+		if _, err := users.GetByUsername(c.Request.Context(), username); err != nil {
+			revokeUserSessions(c.Request.Context(), users, username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errRefreshInvalid.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
 	})
+
+	// 退出登录，当前访问令牌和该会话的刷新令牌全部失效
+	g.POST("/auth/logout", requireAuth(users), requireSession(), func(c *gin.Context) {
+		claims := c.MustGet("tokenClaims").(*accessClaims)
+		if err := revokeSession(c.Request.Context(), users, claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+	})
+
+	me := g.Group("/auth", requireAuth(users))
+
+	// 当前用户资料，个人访问令牌也可以调用
+	me.GET("/me", func(c *gin.Context) {
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, u)
+	})
+
+	// 修改账号和管理令牌需要登录会话，泄露的个人访问令牌不能用来扩大权限
+	me = me.Group("", requireSession())
+	registerTokenRoutes(me, users)
+
+	// 修改显示名称和邮箱
+	me.PUT("/me", func(c *gin.Context) {
+		var req updateProfileRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		if req.DisplayName != nil {
+			name := strings.TrimSpace(*req.DisplayName)
+			if len([]rune(name)) > 64 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "显示名称不能超过64个字符"})
+				return
+			}
+			u.DisplayName = name
+		}
+		if req.Email != nil {
+			email := strings.TrimSpace(*req.Email)
+			if email != "" {
+				if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱格式不正确"})
+					return
+				}
+			}
+			u.Email = email
+		}
+		if err := users.Update(c.Request.Context(), u); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		c.JSON(http.StatusOK, u)
+	})
+
+	// 修改密码，成功后其他登录会话全部失效，返回当前客户端使用的新令牌
+	me.PUT("/password", func(c *gin.Context) {
+		var req struct {
+			OldPassword string `json:"oldPassword"`
+			NewPassword string `json:"newPassword"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.NewPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		if u.PasswordHash == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "单点登录账号没有本地密码"})
+			return
+		}
+		if !checkCurrentPassword(c, u, req.OldPassword, "原密码错误") {
+			return
+		}
+		if err := account.CheckPassword(currentPasswordPolicy(), u.Username, req.NewPassword); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+			return
+		}
+		u.PasswordHash = string(hash)
+		if err := users.Update(c.Request.Context(), u); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+
+		if err := revokeUserSessions(c.Request.Context(), users, u.Username); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注销其他会话失败"})
+			return
+		}
+		securityLog(c.Request.Context(), slog.LevelInfo, "修改密码，已注销其他会话", "ip", c.ClientIP())
+		tokens, err := newSession(c.Request.Context(), users, u.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token":        tokens.AccessToken,
+			"refreshToken": tokens.RefreshToken,
+			"expiresIn":    tokens.ExpiresIn,
+			"message":      "密码已修改",
+		})
+	})
+
+	// 删除账号，需要再次输入密码确认；单点登录账号需要在reauthWindow内重新登录过
+	me.DELETE("/me", func(c *gin.Context) {
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		if u.PasswordHash == "" {
+			// 单点登录账号没有本地密码，要求刚刚通过身份提供者重新登录过
+			claims := c.MustGet("tokenClaims").(*accessClaims)
+			if !claims.authenticatedWithin(reauthWindow) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "请重新通过单点登录验证身份后再删除账号", "reauth": true})
+				return
+			}
+		} else if !checkCurrentPassword(c, u, req.Password, "密码错误") {
+			return
+		}
+		adminMu.Lock()
+		defer adminMu.Unlock()
+		if u.Role == account.RoleAdmin {
+			if err := ensureOtherAdmin(c.Request.Context(), users, u.ID); err != nil {
+				writeAdminError(c, err)
+				return
+			}
+		}
+		if err := users.Delete(c.Request.Context(), u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		data.purge(c.Request.Context(), users, u.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "账号已删除"})
+	})
+}
+
+// 读取当前登录用户，失败时已写入响应
+func currentUser(c *gin.Context, users account.UserStore) (*account.User, bool) {
+	u, err := users.GetByUsername(c.Request.Context(), c.GetString("username"))
+	if errors.Is(err, account.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取用户失败"})
+		return nil, false
+	}
+	return u, true
+}
+
+// 校验当前用户的密码，与登录共用失败计数、等待和锁定，
+// 防止用窃取的访问令牌在这里不受限制地猜测密码。失败时已写入响应
+func checkCurrentPassword(c *gin.Context, u *account.User, password, wrong string) bool {
+	ip := c.ClientIP()
+	if wait, locked := reserveLoginAttempt(u.Username, ip); wait > 0 {
+		writeLoginThrottled(c, wait, locked)
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		recordLoginFailure(c.Request.Context(), u.Username, ip)
+		c.JSON(http.StatusForbidden, gin.H{"error": wrong})
+		return false
+	}
+	recordLoginSuccess(u.Username, ip)
+	return true
 }
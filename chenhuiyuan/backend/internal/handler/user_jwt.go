@@ -1,38 +1,192 @@
 package handler
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+
 	jwt "github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("DEV_SECRET_CHANGE_ME")
+// HS256密钥的最小长度
+const minJWTKeyLen = 32
+
+// 签名密钥集合：用ActiveKey签发，按令牌头中的kid验证
+type jwtKeySet struct {
+	active     string
+	keys       map[string][]byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+var (
+	authMu   sync.RWMutex
+	authKeys *jwtKeySet
+
+	// 未配置密钥时使用的随机密钥，重启后已签发的令牌全部失效
+	ephemeralKeyOnce sync.Once
+	ephemeralKey     []byte
+)
 
-func issueJWT(username string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": username,
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
-		"iat": time.Now().Unix(),
+// 根据配置生成密钥集合
+func newJWTKeySet(cfg ai.AuthConfig) (*jwtKeySet, error) {
+	ks := &jwtKeySet{
+		active:     cfg.ActiveKey,
+		keys:       make(map[string][]byte),
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if len(cfg.Keys) == 0 {
+		ephemeralKeyOnce.Do(func() {
+			ephemeralKey = make([]byte, minJWTKeyLen)
+			rand.Read(ephemeralKey)
+		})
+		ks.active = "ephemeral"
+		ks.keys[ks.active] = ephemeralKey
+		return ks, nil
+	}
+
+	for _, k := range cfg.Keys {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("JWT密钥ID重复: %s", k.ID)
+		}
+		if len(k.Secret) < minJWTKeyLen {
+			return nil, fmt.Errorf("JWT密钥%s长度不足%d字节", k.ID, minJWTKeyLen)
+		}
+		ks.keys[k.ID] = []byte(k.Secret)
+	}
+	if ks.active == "" && len(cfg.Keys) == 1 {
+		ks.active = cfg.Keys[0].ID
+	}
+	if _, ok := ks.keys[ks.active]; !ok {
+		return nil, fmt.Errorf("auth.active_key不是已配置的密钥: %q", ks.active)
+	}
+	return ks, nil
 }
 
-func parseJWT(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
+// 应用登录令牌和登录安全配置，重新加载配置时更新签名密钥、有效期和策略
+func configureAuth(manager *ai.ConfigManager) error {
+	ks, err := newJWTKeySet(manager.Current().Auth)
+	if err != nil {
+		return err
+	}
+	if ks.active == "ephemeral" {
+		slog.Warn("未配置auth.keys或JWT_SECRET，使用随机签名密钥，重启后需重新登录")
+	}
+	setJWTKeys(ks)
+	setSecurityPolicy(manager.Current().Auth)
+
+	manager.OnValidate(func(cfg *ai.AIConfig) error {
+		_, err := newJWTKeySet(cfg.Auth)
+		return err
+	})
+	manager.OnChange(func(old, cfg *ai.AIConfig) {
+		if ks, err := newJWTKeySet(cfg.Auth); err == nil {
+			setJWTKeys(ks)
 		}
-		return jwtSecret, nil
+		setSecurityPolicy(cfg.Auth)
 	})
-	if err != nil || !token.Valid {
-		return "", errors.New("invalid token")
+	return nil
+}
+
+func setJWTKeys(ks *jwtKeySet) {
+	authMu.Lock()
+	defer authMu.Unlock()
+	authKeys = ks
+}
+
+func currentJWTKeys() *jwtKeySet {
+	authMu.RLock()
+	defer authMu.RUnlock()
+	return authKeys
+}
+
+// 访问令牌声明，sid为所属登录会话（刷新令牌家族），auth_time为该会话登录的时间。
+// iat只精确到秒，iat_ms为毫秒精度的签发时间，注销记录据此区分同一秒内注销前后签发的令牌
+type accessClaims struct {
+	Type          string           `json:"typ"`
+	Session       string           `json:"sid"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	IssuedAtMilli int64            `json:"iat_ms,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// 签发时间，旧令牌没有iat_ms时退回到iat
+func (c *accessClaims) issuedAt() time.Time {
+	if c.IssuedAtMilli != 0 {
+		return time.UnixMilli(c.IssuedAtMilli)
+	}
+	return c.IssuedAt.Time
+}
+
+// 会话是否在window内登录过，用于删除账号等需要重新验证身份的操作
+func (c *accessClaims) authenticatedWithin(window time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= window
+}
+
+// 签发访问令牌
+func issueAccessToken(username, session string, authTime time.Time) (string, time.Duration, error) {
+	ks := currentJWTKeys()
+	now := time.Now()
+	claims := accessClaims{
+		Type:          "access",
+		Session:       session,
+		AuthTime:      jwt.NewNumericDate(authTime),
+		IssuedAtMilli: now.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newTokenID(),
+			Subject:   username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ks.accessTTL)),
+		},
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if sub, ok := claims["sub"].(string); ok {
-			return sub, nil
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.active
+	signed, err := token.SignedString(ks.keys[ks.active])
+	return signed, ks.accessTTL, err
+}
+
+// 读取注销记录失败，与令牌无效区分开
+var errTokenCheck = errors.New("校验令牌失败")
+
+// 校验访问令牌：签名、有效期，以及是否已被注销
+func parseAccessToken(ctx context.Context, users account.UserStore, tokenString string) (*accessClaims, error) {
+	ks := currentJWTKeys()
+	claims := &accessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown key id")
 		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, errors.New("invalid token")
 	}
-	return "", errors.New("invalid claims")
+	if claims.Type != "access" || claims.Subject == "" || claims.ID == "" {
+		return nil, errors.New("invalid claims")
+	}
+	revoked, err := tokenRevoked(ctx, users, claims)
+	if err != nil {
+		return nil, errTokenCheck
+	}
+	if revoked {
+		return nil, errors.New("token revoked")
+	}
+	return claims, nil
+}
+
+func newTokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
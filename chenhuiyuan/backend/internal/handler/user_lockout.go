@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 登录失败记录。失败次数超过免等待次数后每次都要等待一段逐次翻倍的时间，
+// 达到阈值后锁定一段时间
+type loginFailures struct {
+	count       int       // 统计窗口内的失败次数
+	last        time.Time // 最近一次失败时间
+	retryAt     time.Time // 此前的登录请求直接拒绝
+	lockedUntil time.Time
+	pending     int // 已预占、尚未得出结果的登录尝试
+}
+
+var (
+	loginMu         sync.Mutex
+	lockoutPolicy   ai.LockoutConfig
+	passwordPolicy  account.PasswordPolicy
+	accountFailures = make(map[string]*loginFailures) // 用户名 -> 失败记录，不存在的用户名同样计数
+	ipFailures      = make(map[string]*loginFailures) // 来源IP -> 失败记录
+)
+
+// 应用密码策略和登录失败限制配置
+func setSecurityPolicy(cfg ai.AuthConfig) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	lockoutPolicy = cfg.Lockout
+	passwordPolicy = account.PasswordPolicy(cfg.Password)
+}
+
+func currentPasswordPolicy() account.PasswordPolicy {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	return passwordPolicy
+}
+
+// 登录前检查账号和IP是否需要等待，返回等待时长和是否处于锁定状态；无需等待时预占一次尝试。
+// 预占在校验密码之前完成，并发的登录请求都会计入，不能借并发绕过等待和锁定。
+// 预占后必须调用recordLoginFailure、recordLoginSuccess或releaseLoginAttempt之一
+func reserveLoginAttempt(username, ip string) (time.Duration, bool) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	now := time.Now()
+	p := lockoutPolicy
+	var wait time.Duration
+	locked := false
+	check := func(f *loginFailures, free int) {
+		switch {
+		case f == nil:
+		case now.Before(f.lockedUntil):
+			locked = true
+			wait = max(wait, f.lockedUntil.Sub(now))
+		case now.Before(f.retryAt):
+			wait = max(wait, f.retryAt.Sub(now))
+		case f.pending > 0 && f.count+f.pending >= free:
+			// 超出免等待次数的尝试只能逐个进行，等前一次得出结果后再计算等待时间
+			wait = max(wait, p.BaseDelay, time.Second)
+		}
+	}
+	check(accountFailures[username], p.FreeAttempts)
+	check(ipFailures[ip], p.IPFreeAttempts)
+	if wait > 0 {
+		return wait, locked
+	}
+	reserve := func(m map[string]*loginFailures, key string) {
+		f := m[key]
+		if f == nil {
+			f = &loginFailures{}
+			m[key] = f
+		}
+		f.pending++
+	}
+	reserve(accountFailures, username)
+	reserve(ipFailures, ip)
+	return 0, false
+}
+
+// 释放预占的尝试，不计为失败（如读取用户失败时）
+func releaseLoginAttempt(username, ip string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	releaseLoginAttemptLocked(username, ip)
+}
+
+// 调用方需持有loginMu。记录已被管理员解锁删除时无需释放
+func releaseLoginAttemptLocked(username, ip string) {
+	for _, f := range []*loginFailures{accountFailures[username], ipFailures[ip]} {
+		if f != nil && f.pending > 0 {
+			f.pending--
+		}
+	}
+}
+
+// 记录一次登录失败并释放预占的尝试
+func recordLoginFailure(ctx context.Context, username, ip string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	releaseLoginAttemptLocked(username, ip)
+	now := time.Now()
+	pruneLoginFailuresLocked(now)
+	p := lockoutPolicy
+
+	securityLog(ctx, slog.LevelWarn, "登录失败", "user", username, "ip", ip)
+	if addLoginFailure(accountFailures, username, p.FreeAttempts, p.AccountThreshold, p, now) {
+		securityLog(ctx, slog.LevelWarn, "账号已临时锁定", "user", username, "ip", ip, "duration", p.Duration.String())
+	}
+	if addLoginFailure(ipFailures, ip, p.IPFreeAttempts, p.IPThreshold, p, now) {
+		securityLog(ctx, slog.LevelWarn, "来源IP已临时锁定", "ip", ip, "duration", p.Duration.String())
+	}
+}
+
+// 登录成功后释放预占的尝试并清除账号的失败记录。IP的记录保留到窗口结束，
+// 避免用自己的账号登录来重置对其他账号的猜测次数
+func recordLoginSuccess(username, ip string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	releaseLoginAttemptLocked(username, ip)
+	if f := accountFailures[username]; f != nil {
+		// 保留同一账号其他进行中的尝试
+		*f = loginFailures{pending: f.pending}
+	}
+}
+
+// 记录一次失败，达到阈值时锁定，返回是否因此锁定
+func addLoginFailure(m map[string]*loginFailures, key string, free, threshold int, p ai.LockoutConfig, now time.Time) bool {
+	f := m[key]
+	if f == nil {
+		f = &loginFailures{}
+		m[key] = f
+	} else if now.Sub(f.last) > p.Window {
+		*f = loginFailures{pending: f.pending}
+	}
+	f.count++
+	f.last = now
+	if f.count >= threshold {
+		f.count = 0
+		f.retryAt = time.Time{}
+		f.lockedUntil = now.Add(p.Duration)
+		return true
+	}
+	if n := f.count - free; n > 0 {
+		f.retryAt = now.Add(loginDelay(p, n))
+	}
+	return false
+}
+
+// 超出免等待次数后第n次失败需要等待的时间
+func loginDelay(p ai.LockoutConfig, n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// 清理已解锁、窗口内没有新失败且没有进行中尝试的记录，调用方需持有loginMu
+func pruneLoginFailuresLocked(now time.Time) {
+	for _, m := range []map[string]*loginFailures{accountFailures, ipFailures} {
+		for key, f := range m {
+			if f.pending == 0 && now.After(f.lockedUntil) && now.Sub(f.last) > lockoutPolicy.Window {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// 管理员解除账号锁定并清空失败次数，ctx中的用户为操作的管理员
+func unlockAccount(ctx context.Context, username string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	delete(accountFailures, username)
+	securityLog(ctx, slog.LevelInfo, "管理员解除账号锁定", "account", username)
+}
+
+// 锁定中的账号或IP
+type lockoutEntry struct {
+	Type        string    `json:"type"` // account或ip
+	Key         string    `json:"key"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// 当前锁定中的账号和IP
+func activeLockouts() []lockoutEntry {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	now := time.Now()
+	list := make([]lockoutEntry, 0)
+	for typ, m := range map[string]map[string]*loginFailures{"account": accountFailures, "ip": ipFailures} {
+		for key, f := range m {
+			if now.Before(f.lockedUntil) {
+				list = append(list, lockoutEntry{Type: typ, Key: key, LockedUntil: f.lockedUntil})
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LockedUntil.Before(list[j].LockedUntil) })
+	return list
+}
+
+// 登录请求被限制时返回429，Retry-After给出需要等待的秒数
+func writeLoginThrottled(c *gin.Context, wait time.Duration, locked bool) {
+	metrics.RateLimitRejections.Inc("login")
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	msg := "登录失败次数过多，请稍后重试"
+	if locked {
+		msg = "登录失败次数过多，已临时锁定，请稍后重试"
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": msg, "retryAfter": seconds})
+}
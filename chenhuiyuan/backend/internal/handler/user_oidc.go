@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/oidc"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 从跳转到身份提供者到回调的最长时间
+const oidcLoginTTL = 10 * time.Minute
+
+// 绑定浏览器和登录请求的cookie，防止回调被他人的授权码冒用（登录CSRF）
+const oidcStateCookie = "oidc_state"
+
+var (
+	errOIDCDomain         = errors.New("该邮箱域名不允许登录")
+	errOIDCNotProvisioned = errors.New("该账号尚未开通，请联系管理员")
+	errOIDCUsername       = errors.New("身份提供者没有返回用户名")
+	errOIDCUsernameTaken  = errors.New("用户名已被本地账号占用，请联系管理员")
+)
+
+// 进行中的单点登录，按state保存nonce和PKCE code_verifier
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *oidc.Provider // 未启用时为nil
+	oidcConfig   ai.OIDCConfig
+	oidcLogins   = make(map[string]*oidcLogin)
+)
+
+// 应用单点登录配置，重新加载配置后使用新的身份提供者
+func configureOIDC(manager *ai.ConfigManager) error {
+	cfg := manager.Current().Auth.OIDC
+	if err := checkOIDCConfig(cfg); err != nil {
+		return err
+	}
+	setOIDCProvider(cfg)
+
+	manager.OnValidate(func(cfg *ai.AIConfig) error {
+		return checkOIDCConfig(cfg.Auth.OIDC)
+	})
+	manager.OnChange(func(old, cfg *ai.AIConfig) {
+		if !reflect.DeepEqual(old.Auth.OIDC, cfg.Auth.OIDC) {
+			setOIDCProvider(cfg.Auth.OIDC)
+		}
+	})
+	return nil
+}
+
+// 启用单点登录时检查必填配置
+func checkOIDCConfig(cfg ai.OIDCConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if err := oidc.Check(oidcClientConfig(cfg)); err != nil {
+		return err
+	}
+	if cfg.UsernameClaim == "" {
+		return errors.New("auth.oidc.username_claim不能为空")
+	}
+	return nil
+}
+
+// 协议相关的部分交给oidc包，用户映射和跳转等配置留在这里使用
+func oidcClientConfig(cfg ai.OIDCConfig) oidc.Config {
+	return oidc.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}
+}
+
+func setOIDCProvider(cfg ai.OIDCConfig) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	oidcProvider = nil
+	oidcConfig = cfg
+	if cfg.Enabled {
+		oidcProvider = oidc.New(oidcClientConfig(cfg))
+	}
+}
+
+// 当前的身份提供者及其配置，未启用时返回nil
+func currentOIDCProvider() (*oidc.Provider, ai.OIDCConfig) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	return oidcProvider, oidcConfig
+}
+
+func registerOIDCRoutes(g *gin.RouterGroup, users account.UserStore) {
+	// 是否启用单点登录，供前端决定是否显示入口
+	g.GET("/auth/oidc", func(c *gin.Context) {
+		p, _ := currentOIDCProvider()
+		c.JSON(http.StatusOK, gin.H{"enabled": p != nil})
+	})
+
+	// 跳转到身份提供者登录
+	g.GET("/auth/oidc/login", func(c *gin.Context) {
+		p, cfg := currentOIDCProvider()
+		if p == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+			return
+		}
+		state := oidc.RandomString()
+		login := &oidcLogin{
+			nonce:    oidc.RandomString(),
+			verifier: oidc.RandomString(),
+			expires:  time.Now().Add(oidcLoginTTL),
+		}
+		authURL, err := p.AuthCodeURL(c.Request.Context(), state, login.nonce, login.verifier)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "连接身份提供者失败", logging.Err(err))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接身份提供者"})
+			return
+		}
+
+		oidcMu.Lock()
+		pruneOIDCLoginsLocked()
+		oidcLogins[state] = login
+		oidcMu.Unlock()
+
+		secure := strings.HasPrefix(cfg.RedirectURL, "https://")
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, state, int(oidcLoginTTL.Seconds()), "/api/auth/oidc", "", secure, true)
+		c.Redirect(http.StatusFound, authURL)
+	})
+
+	// 身份提供者回调：用授权码换取ID令牌，映射到本地用户后签发本服务的令牌
+	g.GET("/auth/oidc/callback", func(c *gin.Context) {
+		p, cfg := currentOIDCProvider()
+		if p == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+			return
+		}
+		if e := c.Query("error"); e != "" {
+			securityLog(c.Request.Context(), slog.LevelWarn, "单点登录被身份提供者拒绝", "ip", c.ClientIP(), "idp_error", e, "description", c.Query("error_description"))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "身份提供者拒绝了登录: " + e})
+			return
+		}
+
+		state := c.Query("state")
+		cookie, _ := c.Cookie(oidcStateCookie)
+		c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", false, true)
+		oidcMu.Lock()
+		login, ok := oidcLogins[state]
+		delete(oidcLogins, state)
+		oidcMu.Unlock()
+		if state == "" || !ok || cookie != state || time.Now().After(login.expires) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "登录请求无效或已过期，请重新登录"})
+			return
+		}
+
+		claims, err := p.Exchange(c.Request.Context(), c.Query("code"), login.verifier, login.nonce)
+		if err != nil {
+			securityLog(c.Request.Context(), slog.LevelWarn, "单点登录失败", "ip", c.ClientIP(), logging.Err(err))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "单点登录失败"})
+			return
+		}
+		u, err := oidcUser(c.Request.Context(), users, cfg, claims)
+		if err != nil {
+			securityLog(c.Request.Context(), slog.LevelWarn, "单点登录被拒绝", "issuer", claims.Issuer, "sub", claims.Subject, "ip", c.ClientIP(), logging.Err(err))
+			switch {
+			case errors.Is(err, errOIDCDomain), errors.Is(err, errOIDCNotProvisioned):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, errOIDCUsernameTaken):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, errOIDCUsername):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			}
+			return
+		}
+
+		tokens, err := newSession(c.Request.Context(), users, u.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+			return
+		}
+		securityLog(c.Request.Context(), slog.LevelInfo, "单点登录成功", "user", u.Username, "issuer", claims.Issuer, "ip", c.ClientIP())
+
+		// 令牌放在URL片段中，不会发送到前端服务器，也不会出现在访问日志里
+		if redirect := cfg.SuccessRedirect; redirect != "" {
+			fragment := url.Values{
+				"token":        {tokens.AccessToken},
+				"refreshToken": {tokens.RefreshToken},
+				"expiresIn":    {strconv.Itoa(tokens.ExpiresIn)},
+			}
+			c.Redirect(http.StatusFound, redirect+"#"+fragment.Encode())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token":        tokens.AccessToken,
+			"refreshToken": tokens.RefreshToken,
+			"expiresIn":    tokens.ExpiresIn,
+			"message":      "登录成功",
+		})
+	})
+}
+
+// 按issuer和sub查找已关联的本地用户并同步资料，首次登录时按配置自动创建
+func oidcUser(ctx context.Context, users account.UserStore, cfg ai.OIDCConfig, claims *oidc.Claims) (*account.User, error) {
+	domainAllowed := slices.ContainsFunc(cfg.AllowedDomains, func(d string) bool { return strings.EqualFold(d, claims.EmailDomain()) })
+	if len(cfg.AllowedDomains) > 0 && (!claims.EmailVerified || !domainAllowed) {
+		return nil, errOIDCDomain
+	}
+	// 只同步身份提供者确认过的邮箱
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+
+	u, err := users.GetByIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		if (claims.Name != "" && claims.Name != u.DisplayName) || (email != "" && email != u.Email) {
+			u.DisplayName = cmp.Or(claims.Name, u.DisplayName)
+			u.Email = cmp.Or(email, u.Email)
+			if err := users.Update(ctx, u); err != nil {
+				return nil, err
+			}
+		}
+		return u, nil
+	}
+	if !errors.Is(err, account.ErrUserNotFound) {
+		return nil, err
+	}
+	if !cfg.AutoProvision {
+		return nil, errOIDCNotProvisioned
+	}
+
+	username := strings.TrimSpace(claims.String(cfg.UsernameClaim))
+	if username == "" {
+		return nil, errOIDCUsername
+	}
+	// 自动创建的用户不会是管理员，第一个管理员只能来自auth.initial_admin
+	role := cfg.DefaultRole
+	if role == "" {
+		role = account.RoleEditor
+	}
+	// 没有本地密码，只能通过单点登录
+	u = &account.User{
+		ID:          uuid.NewString(),
+		Username:    username,
+		DisplayName: claims.Name,
+		Email:       email,
+		Role:        role,
+	}
+	// 创建和关联在同一事务中完成，失败时不会留下占用用户名的账号
+	if err := users.CreateWithIdentity(ctx, u, claims.Issuer, claims.Subject); err != nil {
+		if errors.Is(err, account.ErrUsernameTaken) {
+			return nil, errOIDCUsernameTaken
+		}
+		return nil, err
+	}
+	securityLog(ctx, slog.LevelInfo, "单点登录自动创建用户", "user", u.Username, "role", u.Role, "issuer", claims.Issuer)
+	return u, nil
+}
+
+// 清理超时未回调的登录，调用方需持有oidcMu
+func pruneOIDCLoginsLocked() {
+	now := time.Now()
+	for state, login := range oidcLogins {
+		if now.After(login.expires) {
+			delete(oidcLogins, state)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/oidc/oidctest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 启用指向idp的单点登录，返回只注册了单点登录路由的引擎
+func newOIDCTestRouter(t *testing.T, idp *oidctest.Server, users account.UserStore, configure func(*ai.OIDCConfig)) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ks, err := newJWTKeySet(ai.AuthConfig{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevKeys := currentJWTKeys()
+	setJWTKeys(ks)
+
+	cfg := ai.OIDCConfig{
+		Enabled:       true,
+		Issuer:        idp.URL,
+		ClientID:      "writer",
+		RedirectURL:   "https://writer.example.com/api/auth/oidc/callback",
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: "preferred_username",
+		AutoProvision: true,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	setOIDCProvider(cfg)
+	t.Cleanup(func() {
+		setOIDCProvider(ai.OIDCConfig{})
+		setJWTKeys(prevKeys)
+	})
+
+	r := gin.New()
+	registerOIDCRoutes(r.Group("/api"), users)
+	return r
+}
+
+// 发起登录，返回授权地址和绑定浏览器的state cookie
+func startOIDCLogin(t *testing.T, r *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, body %s", w.Code, w.Body)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			return w.Header().Get("Location"), c
+		}
+	}
+	t.Fatal("没有设置state cookie")
+	return "", nil
+}
+
+// 携带state、授权码和cookie请求回调
+func oidcCallback(r *gin.Engine, state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	q := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+q.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// 完整的单点登录流程，claims覆盖身份提供者签发的ID令牌声明
+func completeOIDCLogin(t *testing.T, r *gin.Engine, idp *oidctest.Server, claims map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	authURL, cookie := startOIDCLogin(t, r)
+	code, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oidcCallback(r, stateOf(t, authURL), code, cookie)
+}
+
+func stateOf(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	users := account.NewMemoryStore()
+	r := newOIDCTestRouter(t, idp, users, nil)
+	ctx := context.Background()
+
+	w := completeOIDCLogin(t, r, idp, map[string]any{
+		"preferred_username": "alice",
+		"name":               "Alice",
+		"email":              "alice@example.com",
+		"email_verified":     false,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := parseAccessToken(ctx, users, resp.Token)
+	if err != nil || claims.Subject != "alice" || resp.RefreshToken == "" {
+		t.Fatalf("签发的令牌无效: %v", err)
+	}
+
+	u, err := users.GetByIdentity(ctx, idp.URL, "subject-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" || u.Role != account.RoleEditor || u.PasswordHash != "" {
+		t.Errorf("创建的用户 = %+v", u)
+	}
+	// 未验证的邮箱不同步
+	if u.DisplayName != "Alice" || u.Email != "" {
+		t.Errorf("资料 = %q/%q", u.DisplayName, u.Email)
+	}
+
+	// 再次登录按issuer和sub找到同一用户并同步资料，不再创建
+	w = completeOIDCLogin(t, r, idp, map[string]any{
+		"preferred_username": "renamed",
+		"name":               "Alice Liddell",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("second callback status = %d, body %s", w.Code, w.Body)
+	}
+	u, err = users.GetByIdentity(ctx, idp.URL, "subject-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" || u.DisplayName != "Alice Liddell" || u.Email != "alice@example.com" {
+		t.Errorf("同步后的用户 = %+v", u)
+	}
+	if _, err := users.GetByUsername(ctx, "renamed"); err == nil {
+		t.Error("已关联的身份不应创建新用户")
+	}
+}
+
+func TestOIDCLoginDefaultRole(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	users := account.NewMemoryStore()
+	r := newOIDCTestRouter(t, idp, users, func(cfg *ai.OIDCConfig) { cfg.DefaultRole = account.RoleViewer })
+
+	if w := completeOIDCLogin(t, r, idp, map[string]any{"preferred_username": "bob"}); w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, body %s", w.Code, w.Body)
+	}
+	u, err := users.GetByUsername(context.Background(), "bob")
+	if err != nil || u.Role != account.RoleViewer {
+		t.Fatalf("user = %+v, err = %v", u, err)
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*ai.OIDCConfig)
+		claims    map[string]any
+		local     string // 预先存在的本地用户名
+		want      int
+	}{
+		{
+			name:   "ID令牌nonce不匹配",
+			claims: map[string]any{"preferred_username": "alice", "nonce": "replayed"},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "ID令牌已过期",
+			claims: map[string]any{"preferred_username": "alice", "exp": time.Now().Add(-time.Hour).Unix()},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:      "邮箱域名不允许",
+			configure: func(cfg *ai.OIDCConfig) { cfg.AllowedDomains = []string{"corp.example.com"} },
+			claims:    map[string]any{"preferred_username": "alice", "email": "alice@example.com", "email_verified": true},
+			want:      http.StatusForbidden,
+		},
+		{
+			name:      "邮箱未验证",
+			configure: func(cfg *ai.OIDCConfig) { cfg.AllowedDomains = []string{"corp.example.com"} },
+			claims:    map[string]any{"preferred_username": "alice", "email": "alice@corp.example.com", "email_verified": false},
+			want:      http.StatusForbidden,
+		},
+		{
+			name:      "没有邮箱",
+			configure: func(cfg *ai.OIDCConfig) { cfg.AllowedDomains = []string{"corp.example.com"} },
+			claims:    map[string]any{"preferred_username": "alice"},
+			want:      http.StatusForbidden,
+		},
+		{
+			name:      "未开启自动创建",
+			configure: func(cfg *ai.OIDCConfig) { cfg.AutoProvision = false },
+			claims:    map[string]any{"preferred_username": "alice"},
+			want:      http.StatusForbidden,
+		},
+		{
+			name:   "没有用户名声明",
+			claims: map[string]any{"name": "Alice"},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "用户名被本地账号占用",
+			claims: map[string]any{"preferred_username": "alice"},
+			local:  "alice",
+			want:   http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := oidctest.NewServer(t)
+			users := account.NewMemoryStore()
+			ctx := context.Background()
+			if tt.local != "" {
+				if err := users.Create(ctx, &account.User{ID: "local", Username: tt.local, PasswordHash: "x"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := newOIDCTestRouter(t, idp, users, tt.configure)
+
+			w := completeOIDCLogin(t, r, idp, tt.claims)
+			if w.Code != tt.want {
+				t.Fatalf("callback status = %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+			if _, err := users.GetByIdentity(ctx, idp.URL, "subject-1"); err == nil {
+				t.Error("被拒绝的登录不应关联用户")
+			}
+		})
+	}
+}
+
+// 创建用户和关联身份失败的存储
+type failingIdentityStore struct {
+	*account.MemoryStore
+	fail bool
+}
+
+func (s *failingIdentityStore) CreateWithIdentity(ctx context.Context, u *account.User, issuer, subject string) error {
+	if s.fail {
+		return errors.New("数据库暂时不可用")
+	}
+	return s.MemoryStore.CreateWithIdentity(ctx, u, issuer, subject)
+}
+
+// 首次登录时创建失败不能留下账号或占用用户名，恢复后同一身份可以正常登录
+func TestOIDCLoginProvisionFailure(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	users := &failingIdentityStore{MemoryStore: account.NewMemoryStore(), fail: true}
+	r := newOIDCTestRouter(t, idp, users, nil)
+	ctx := context.Background()
+	claims := map[string]any{"preferred_username": "alice"}
+
+	if w := completeOIDCLogin(t, r, idp, claims); w.Code != http.StatusInternalServerError {
+		t.Fatalf("callback status = %d, body %s", w.Code, w.Body)
+	}
+	if _, err := users.GetByUsername(ctx, "alice"); err == nil {
+		t.Fatal("创建失败后不应留下用户")
+	}
+
+	users.fail = false
+	if w := completeOIDCLogin(t, r, idp, claims); w.Code != http.StatusOK {
+		t.Fatalf("retry status = %d, body %s", w.Code, w.Body)
+	}
+	if u, err := users.GetByIdentity(ctx, idp.URL, "subject-1"); err != nil || u.Username != "alice" {
+		t.Fatalf("user = %+v, err = %v", u, err)
+	}
+}
+
+func TestOIDCLoginAllowedDomain(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	users := account.NewMemoryStore()
+	r := newOIDCTestRouter(t, idp, users, func(cfg *ai.OIDCConfig) { cfg.AllowedDomains = []string{"Corp.Example.com"} })
+
+	w := completeOIDCLogin(t, r, idp, map[string]any{"preferred_username": "alice", "email": "alice@corp.example.COM", "email_verified": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, body %s", w.Code, w.Body)
+	}
+}
+
+// state必须来自本服务发起的登录，并与同一浏览器的cookie一致，且只能使用一次
+func TestOIDCCallbackState(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	users := account.NewMemoryStore()
+	r := newOIDCTestRouter(t, idp, users, nil)
+	claims := map[string]any{"preferred_username": "alice"}
+
+	t.Run("缺少cookie", func(t *testing.T) {
+		authURL, _ := startOIDCLogin(t, r)
+		code, _ := idp.Authorize(authURL, claims)
+		if w := oidcCallback(r, stateOf(t, authURL), code, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("cookie属于另一次登录", func(t *testing.T) {
+		authURL, _ := startOIDCLogin(t, r)
+		_, other := startOIDCLogin(t, r)
+		code, _ := idp.Authorize(authURL, claims)
+		if w := oidcCallback(r, stateOf(t, authURL), code, other); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("未知state", func(t *testing.T) {
+		cookie := &http.Cookie{Name: oidcStateCookie, Value: "forged"}
+		if w := oidcCallback(r, "forged", "code", cookie); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("state重复使用", func(t *testing.T) {
+		authURL, cookie := startOIDCLogin(t, r)
+		code, _ := idp.Authorize(authURL, claims)
+		if w := oidcCallback(r, stateOf(t, authURL), code, cookie); w.Code != http.StatusOK {
+			t.Fatalf("first status = %d, body %s", w.Code, w.Body)
+		}
+		code, _ = idp.Authorize(authURL, claims)
+		if w := oidcCallback(r, stateOf(t, authURL), code, cookie); w.Code != http.StatusBadRequest {
+			t.Fatalf("replay status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("已过期", func(t *testing.T) {
+		authURL, cookie := startOIDCLogin(t, r)
+		state := stateOf(t, authURL)
+		oidcMu.Lock()
+		oidcLogins[state].expires = time.Now().Add(-time.Second)
+		oidcMu.Unlock()
+		code, _ := idp.Authorize(authURL, claims)
+		if w := oidcCallback(r, state, code, cookie); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setOIDCProvider(ai.OIDCConfig{})
+	r := gin.New()
+	registerOIDCRoutes(r.Group("/api"), account.NewMemoryStore())
+
+	for _, path := range []string{"/api/auth/oidc/login", "/api/auth/oidc/callback"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s status = %d", path, w.Code)
+		}
+	}
+}
+
+// 单点登录账号没有本地密码，删除账号要求会话刚刚登录过
+func TestOIDCUserDeleteAccount(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	users := account.NewMemoryStore()
+	r := newOIDCTestRouter(t, idp, users, nil)
+	svc := ai.NewService()
+	registerUserRoutes(r.Group("/api"), users, &userData{
+		jobs:      ai.NewJobQueue(svc, ai.JobsConfig{}),
+		gens:      ai.NewGenerationRegistry(time.Minute),
+		summaries: newDocumentSummarizer(svc),
+		index:     newDocumentIndex(ai.RetrievalConfig{}),
+	})
+	ctx := context.Background()
+
+	w := completeOIDCLogin(t, r, idp, map[string]any{"preferred_username": "alice"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, body %s", w.Code, w.Body)
+	}
+	var fresh tokenPair
+	if err := json.Unmarshal(w.Body.Bytes(), &fresh); err != nil {
+		t.Fatal(err)
+	}
+	// 很早之前登录、之后一直刷新的会话
+	stale, err := issueTokenPair(ctx, users, "alice", newTokenID(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleteMe := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/auth/me", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := deleteMe(stale.AccessToken); w.Code != http.StatusForbidden {
+		t.Fatalf("stale session status = %d, body %s", w.Code, w.Body)
+	}
+	if w := deleteMe(fresh.AccessToken); w.Code != http.StatusOK {
+		t.Fatalf("fresh session status = %d, body %s", w.Code, w.Body)
+	}
+	if _, err := users.GetByUsername(ctx, "alice"); err == nil {
+		t.Fatal("账号应已删除")
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/ai"
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/redact"
+)
+
+// 按用户名保存的用户数据，删除账号时一并清理
+type userData struct {
+	jobs      *ai.JobQueue
+	gens      *ai.GenerationRegistry
+	summaries *documentSummarizer
+	index     *documentIndex
+}
+
+// 删除username的文档（连同摘要和检索索引）、异步任务、生成记录、风格档案、脱敏策略和会话的占位符对应关系、术语表和对比记录，
+// 并注销其全部会话。敏感内容命中记录属于审计数据，予以保留。
+// 用户名由账号存储保留不再分配，清理之后不会有新账号继承这些数据
+func (d *userData) purge(ctx context.Context, users account.UserStore, username string) {
+	var docIDs []string
+	docsMu.Lock()
+	for id, doc := range inMemoryDocs {
+		if doc.Owner == username {
+			delete(inMemoryDocs, id)
+			docIDs = append(docIDs, id)
+		}
+	}
+	docsMu.Unlock()
+	for _, id := range docIDs {
+		d.summaries.Forget(id)
+	}
+	d.index.Drop(username)
+
+	d.jobs.Purge(username)
+	d.gens.Purge(username)
+
+	styleMu.Lock()
+	delete(styleProfiles, username)
+	styleMu.Unlock()
+
+	redactionMu.Lock()
+	delete(redactionPolicies, username)
+	redactionMu.Unlock()
+	redact.Forget(username)
+
+	glossaryMu.Lock()
+	delete(glossaries, username)
+	glossaryMu.Unlock()
+
+	comparisonsMu.Lock()
+	for id, cmp := range comparisons {
+		if cmp.Owner == username {
+			delete(comparisons, id)
+		}
+	}
+	comparisonsMu.Unlock()
+
+	if err := revokeUserSessions(ctx, users, username); err != nil {
+		slog.ErrorContext(ctx, "注销已删除账号的会话失败", "account", username, logging.Err(err))
+	}
+	securityLog(ctx, slog.LevelInfo, "已删除账号及其数据", "account", username, "documents", len(docIDs))
+}
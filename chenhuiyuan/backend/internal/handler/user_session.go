@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/logging"
+)
+
+var (
+	errRefreshInvalid = errors.New("刷新令牌无效或已过期")
+	errRefreshReused  = errors.New("刷新令牌已被使用，该登录会话已注销")
+)
+
+// 登录成功后创建会话，返回访问令牌和刷新令牌。刷新令牌和注销记录保存在用户存储中，
+// 服务重启后会话和注销都保持有效
+func newSession(ctx context.Context, users account.UserStore, username string) (tokenPair, error) {
+	return issueTokenPair(ctx, users, username, newTokenID(), time.Now())
+}
+
+// 用刷新令牌换取新的令牌对，旧刷新令牌随即失效。返回令牌所属的用户名。
+// 已使用过的令牌再次出现说明可能被盗用，注销整个会话
+func refreshSession(ctx context.Context, users account.UserStore, token string) (tokenPair, string, error) {
+	rt, err := users.UseRefreshToken(ctx, hashToken(token))
+	if errors.Is(err, account.ErrRefreshTokenNotFound) {
+		return tokenPair{}, "", errRefreshInvalid
+	}
+	if err != nil {
+		return tokenPair{}, "", err
+	}
+	if rt.Used {
+		securityLog(ctx, slog.LevelWarn, "刷新令牌重复使用，已注销会话", "user", rt.Username)
+		if err := revokeSessionTokens(ctx, users, rt.Session); err != nil {
+			return tokenPair{}, "", err
+		}
+		return tokenPair{}, "", errRefreshReused
+	}
+
+	tokens, err := issueTokenPair(ctx, users, rt.Username, rt.Session, rt.AuthTime)
+	return tokens, rt.Username, err
+}
+
+// 签发访问令牌和同一会话的新刷新令牌，authTime为会话登录的时间
+func issueTokenPair(ctx context.Context, users account.UserStore, username, session string, authTime time.Time) (tokenPair, error) {
+	access, ttl, err := issueAccessToken(username, session, authTime)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return tokenPair{}, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := users.PruneSessions(ctx, time.Now()); err != nil {
+		slog.WarnContext(ctx, "清理过期会话失败", logging.Err(err))
+	}
+	err = users.CreateRefreshToken(ctx, &account.RefreshToken{
+		Hash:      hashToken(refresh),
+		Username:  username,
+		Session:   session,
+		AuthTime:  authTime,
+		ExpiresAt: time.Now().Add(currentJWTKeys().refreshTTL),
+	})
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int(ttl.Seconds())}, nil
+}
+
+// 退出登录：注销当前访问令牌和所属会话的全部刷新令牌
+func revokeSession(ctx context.Context, users account.UserStore, claims *accessClaims) error {
+	err := users.Revoke(ctx, account.Revocation{Kind: account.RevokeToken, Key: claims.ID, ExpiresAt: claims.ExpiresAt.Time})
+	if err != nil {
+		return err
+	}
+	return revokeSessionTokens(ctx, users, claims.Session)
+}
+
+// 注销会话的全部刷新令牌和已签发的访问令牌
+func revokeSessionTokens(ctx context.Context, users account.UserStore, session string) error {
+	if err := users.DeleteSessionRefreshTokens(ctx, session); err != nil {
+		return err
+	}
+	// 会话中已签发的访问令牌最晚在一个有效期后过期
+	return users.Revoke(ctx, account.Revocation{
+		Kind:      account.RevokeSession,
+		Key:       session,
+		ExpiresAt: time.Now().Add(currentJWTKeys().accessTTL),
+	})
+}
+
+// 注销用户的全部登录会话（修改密码、删除账号时），之前签发的访问令牌一并失效
+func revokeUserSessions(ctx context.Context, users account.UserStore, username string) error {
+	if err := users.DeleteUserRefreshTokens(ctx, username); err != nil {
+		return err
+	}
+	// 签发时间（iat_ms）精确到毫秒：注销当前这一毫秒及之前签发的令牌，并等到下一毫秒再返回，
+	// 之后签发的新令牌（如修改密码后返回的令牌）都不早于分界时间
+	before := time.Now().Truncate(time.Millisecond).Add(time.Millisecond)
+	err := users.Revoke(ctx, account.Revocation{
+		Kind:      account.RevokeUser,
+		Key:       username,
+		Before:    before,
+		ExpiresAt: before.Add(currentJWTKeys().accessTTL),
+	})
+	time.Sleep(time.Until(before))
+	return err
+}
+
+// 访问令牌是否已被注销
+func tokenRevoked(ctx context.Context, users account.UserStore, claims *accessClaims) (bool, error) {
+	return users.Revoked(ctx, claims.ID, claims.Session, claims.Subject, claims.issuedAt())
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 登录和刷新接口返回的令牌
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // 访问令牌有效秒数
+}
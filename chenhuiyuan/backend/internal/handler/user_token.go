@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/account"
+	"ai-writing-assistant/internal/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 个人访问令牌的固定前缀，用于和JWT区分，也便于密钥扫描工具识别
+const personalTokenPrefix = "aiw_pat_"
+
+// 最近使用时间的记录粒度，避免每个请求都写数据库
+const tokenTouchInterval = time.Minute
+
+var errPersonalTokenInvalid = errors.New("个人访问令牌无效或已过期")
+
+// 创建令牌请求，expiresInDays为0表示不过期
+type createTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+// 个人访问令牌管理，只能在登录会话中调用
+func registerTokenRoutes(g *gin.RouterGroup, users account.UserStore) {
+	g.GET("/tokens", func(c *gin.Context) {
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		list, err := users.ListTokens(c.Request.Context(), u.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取令牌失败"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	// 创建令牌，明文只在响应中返回这一次
+	g.POST("/tokens", func(c *gin.Context) {
+		var req createTokenRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len([]rune(req.Name)) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "令牌名称不能为空且不能超过64个字符"})
+			return
+		}
+		if len(req.Scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要一个权限范围"})
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !account.ValidScope(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的权限范围: " + scope, "scopes": account.Scopes})
+				return
+			}
+		}
+		if req.ExpiresInDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "有效天数不能为负数"})
+			return
+		}
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+
+		plain, err := newPersonalToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+			return
+		}
+		scopes := slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+		t := &account.PersonalToken{
+			ID:     uuid.NewString(),
+			UserID: u.ID,
+			Name:   req.Name,
+			Prefix: plain[:len(personalTokenPrefix)+6],
+			Hash:   hashToken(plain),
+			Scopes: scopes,
+		}
+		if req.ExpiresInDays > 0 {
+			exp := time.Now().AddDate(0, 0, req.ExpiresInDays)
+			t.ExpiresAt = &exp
+		}
+		if err := users.CreateToken(c.Request.Context(), t); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存令牌失败"})
+			return
+		}
+		securityLog(c.Request.Context(), slog.LevelInfo, "创建个人访问令牌", "token", t.ID, "scopes", t.Scopes)
+		c.JSON(http.StatusOK, gin.H{"token": plain, "info": t, "message": "令牌只显示一次，请妥善保存"})
+	})
+
+	// 吊销令牌，立即失效
+	g.DELETE("/tokens/:id", func(c *gin.Context) {
+		u, ok := currentUser(c, users)
+		if !ok {
+			return
+		}
+		err := users.DeleteToken(c.Request.Context(), u.ID, c.Param("id"))
+		if errors.Is(err, account.ErrTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "令牌不存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		securityLog(c.Request.Context(), slog.LevelInfo, "吊销个人访问令牌", "token", c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"message": "令牌已吊销"})
+	})
+}
+
+func newPersonalToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return personalTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 校验个人访问令牌，返回令牌及其所属用户，并记录使用时间
+func authenticatePersonalToken(ctx context.Context, users account.UserStore, token, ip string) (*account.PersonalToken, *account.User, error) {
+	t, err := users.GetTokenByHash(ctx, hashToken(token))
+	if errors.Is(err, account.ErrTokenNotFound) {
+		return nil, nil, errPersonalTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if t.Expired(now) {
+		return nil, nil, errPersonalTokenInvalid
+	}
+	u, err := users.GetByID(ctx, t.UserID)
+	if errors.Is(err, account.ErrUserNotFound) {
+		return nil, nil, errPersonalTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= tokenTouchInterval || t.LastUsedIP != ip {
+		if err := users.TouchToken(ctx, t.ID, now, ip); err != nil {
+			slog.WarnContext(ctx, "记录令牌使用时间失败", "token", t.ID, logging.Err(err))
+		}
+	}
+	return t, u, nil
+}
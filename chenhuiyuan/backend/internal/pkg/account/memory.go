@@ -0,0 +1,308 @@
+package account
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 内存用户存储，重启后数据丢失，用于开发和测试
+type MemoryStore struct {
+	mu         sync.RWMutex
+	byID       map[string]*User
+	byUsername map[string]string // 用户名 -> ID
+	tokens     map[string]*PersonalToken
+	identities map[identityKey]string   // 单点登录身份 -> 用户ID
+	deleted    map[string]bool          // 已删除用户的用户名，不再分配
+	refresh    map[string]*RefreshToken // 令牌哈希 -> 刷新令牌
+	revoked    map[revocationKey]Revocation
+}
+
+type identityKey struct {
+	issuer, subject string
+}
+
+type revocationKey struct {
+	kind, key string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byID:       make(map[string]*User),
+		byUsername: make(map[string]string),
+		tokens:     make(map[string]*PersonalToken),
+		identities: make(map[identityKey]string),
+		deleted:    make(map[string]bool),
+		refresh:    make(map[string]*RefreshToken),
+		revoked:    make(map[revocationKey]Revocation),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createLocked(u)
+}
+
+func (s *MemoryStore) createLocked(u *User) error {
+	if _, ok := s.byUsername[u.Username]; ok || s.deleted[u.Username] {
+		return ErrUsernameTaken
+	}
+	if u.Role == "" {
+		u.Role = RoleEditor
+	}
+	now := time.Now()
+	u.CreatedAt, u.UpdatedAt = now, now
+	saved := *u
+	s.byID[u.ID] = &saved
+	s.byUsername[u.Username] = u.ID
+	return nil
+}
+
+func (s *MemoryStore) GetByID(ctx context.Context, id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := *u
+	return &found, nil
+}
+
+func (s *MemoryStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	id, ok := s.byUsername[username]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.GetByID(ctx, id)
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*User, error) {
+	s.mu.RLock()
+	list := make([]*User, 0, len(s.byID))
+	for _, u := range s.byID {
+		found := *u
+		list = append(list, &found)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.Before(list[k].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved, ok := s.byID[u.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.Username = saved.Username
+	u.CreatedAt = saved.CreatedAt
+	u.UpdatedAt = time.Now()
+	*saved = *u
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(s.byID, id)
+	delete(s.byUsername, u.Username)
+	s.deleted[u.Username] = true
+	for tid, t := range s.tokens {
+		if t.UserID == id {
+			delete(s.tokens, tid)
+		}
+	}
+	for key, uid := range s.identities {
+		if uid == id {
+			delete(s.identities, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetByIdentity(ctx context.Context, issuer, subject string) (*User, error) {
+	s.mu.RLock()
+	id, ok := s.identities[identityKey{issuer, subject}]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return s.GetByID(ctx, id)
+}
+
+func (s *MemoryStore) CreateWithIdentity(ctx context.Context, u *User, issuer, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.createLocked(u); err != nil {
+		return err
+	}
+	s.identities[identityKey{issuer, subject}] = u.ID
+	return nil
+}
+
+func (s *MemoryStore) CreateToken(ctx context.Context, t *PersonalToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[t.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	t.CreatedAt = time.Now()
+	s.tokens[t.ID] = copyToken(t)
+	return nil
+}
+
+func (s *MemoryStore) GetTokenByHash(ctx context.Context, hash string) (*PersonalToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tokens {
+		if t.Hash == hash {
+			return copyToken(t), nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *MemoryStore) ListTokens(ctx context.Context, userID string) ([]*PersonalToken, error) {
+	s.mu.RLock()
+	list := make([]*PersonalToken, 0)
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			list = append(list, copyToken(t))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.Before(list[k].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteToken(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok || t.UserID != userID {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+func (s *MemoryStore) TouchToken(ctx context.Context, id string, at time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	t.LastUsedAt = &at
+	t.LastUsedIP = ip
+	return nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, t *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *t
+	s.refresh[t.Hash] = &saved
+	return nil
+}
+
+func (s *MemoryStore) UseRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.refresh[hash]
+	if !ok || time.Now().After(t.ExpiresAt) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	found := *t
+	t.Used = true
+	return &found, nil
+}
+
+func (s *MemoryStore) DeleteSessionRefreshTokens(ctx context.Context, session string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.refresh {
+		if t.Session == session {
+			delete(s.refresh, hash)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteUserRefreshTokens(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.refresh {
+		if t.Username == username {
+			delete(s.refresh, hash)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, r Revocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[revocationKey{r.Kind, r.Key}] = r
+	return nil
+}
+
+func (s *MemoryStore) Revoked(ctx context.Context, tokenID, session, username string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.revoked[revocationKey{RevokeToken, tokenID}]; ok {
+		return true, nil
+	}
+	if _, ok := s.revoked[revocationKey{RevokeSession, session}]; ok {
+		return true, nil
+	}
+	r, ok := s.revoked[revocationKey{RevokeUser, username}]
+	return ok && issuedAt.Before(r.Before), nil
+}
+
+func (s *MemoryStore) PruneSessions(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.refresh {
+		if now.After(t.ExpiresAt) {
+			delete(s.refresh, hash)
+		}
+	}
+	for key, r := range s.revoked {
+		if now.After(r.ExpiresAt) {
+			delete(s.revoked, key)
+		}
+	}
+	return nil
+}
+
+// 令牌副本，避免调用方修改存储中的切片和时间
+func copyToken(t *PersonalToken) *PersonalToken {
+	c := *t
+	c.Scopes = append([]string(nil), t.Scopes...)
+	if t.ExpiresAt != nil {
+		exp := *t.ExpiresAt
+		c.ExpiresAt = &exp
+	}
+	if t.LastUsedAt != nil {
+		used := *t.LastUsedAt
+		c.LastUsedAt = &used
+	}
+	return &c
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
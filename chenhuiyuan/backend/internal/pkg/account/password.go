@@ -0,0 +1,74 @@
+package account
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt只使用密码的前72字节
+const maxPasswordBytes = 72
+
+// 常见弱密码（小写比较），长度满足要求但极易被猜中
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"12345678": true, "123456789": true, "1234567890": true, "11111111": true,
+	"88888888": true, "00000000": true, "66666666": true, "123123123": true,
+	"qwerty123": true, "qwertyuiop": true, "1qaz2wsx": true, "1q2w3e4r": true,
+	"abc12345": true, "abcd1234": true, "a1234567": true, "aa123456": true,
+	"asdf1234": true, "zxcvbnm123": true, "qq123456": true, "iloveyou": true,
+	"admin123": true, "admin888": true, "welcome1": true, "letmein1": true,
+	"woaini1314": true, "5201314520": true, "a123456789": true, "123456abc": true,
+}
+
+// 密码策略
+type PasswordPolicy struct {
+	MinLength      int  // 最少字符数
+	MinClasses     int  // 至少包含几类字符：小写字母、大写字母、数字、符号
+	RejectUsername bool // 不能包含用户名
+	RejectCommon   bool // 拒绝常见弱密码
+}
+
+// 按密码策略检查密码，不符合时返回可直接展示给用户的错误
+func CheckPassword(p PasswordPolicy, username, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("密码长度至少为%d个字符", p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("密码不能超过%d字节", maxPasswordBytes)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("密码至少需要包含小写字母、大写字母、数字、符号中的%d类", p.MinClasses)
+	}
+
+	lowered := strings.ToLower(password)
+	// 过短的用户名容易误伤正常密码
+	if p.RejectUsername && utf8.RuneCountInString(username) >= 3 && strings.Contains(lowered, strings.ToLower(username)) {
+		return fmt.Errorf("密码不能包含用户名")
+	}
+	if p.RejectCommon && commonPasswords[lowered] {
+		return fmt.Errorf("密码过于常见，请更换")
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package account
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrRefreshTokenNotFound = errors.New("刷新令牌不存在或已过期")
+
+// 登录会话的刷新令牌，只保存哈希。每次刷新后旧令牌标记为已使用，
+// 再次出现说明令牌可能被盗用
+type RefreshToken struct {
+	Hash      string
+	Username  string
+	Session   string
+	AuthTime  time.Time // 会话登录（验证身份）的时间，刷新后保持不变
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// 访问令牌注销记录的类型
+const (
+	RevokeToken   = "token"   // 单个访问令牌，Key为令牌ID（jti）
+	RevokeSession = "session" // 会话中签发的全部访问令牌，Key为会话ID
+	RevokeUser    = "user"    // 用户在Before之前签发的全部访问令牌，Key为用户名
+)
+
+// 访问令牌注销记录。访问令牌本身无状态，在有效期内需要按记录拒绝
+type Revocation struct {
+	Kind      string
+	Key       string
+	Before    time.Time // 仅用于RevokeUser
+	ExpiresAt time.Time // 相关访问令牌全部过期的时间，之后记录可以清理
+}
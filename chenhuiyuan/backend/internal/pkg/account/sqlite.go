@@ -0,0 +1,430 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// 数据库结构迁移，按顺序执行，已执行到第几条记录在PRAGMA user_version中。
+// 只能在末尾追加，不能修改已发布的语句
+var migrations = []string{
+	`CREATE TABLE users (
+		id            TEXT PRIMARY KEY,
+		username      TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		display_name  TEXT NOT NULL DEFAULT '',
+		email         TEXT NOT NULL DEFAULT '',
+		created_at    INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL
+	)`,
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'editor'`,
+	// 升级前已有的第一个用户成为管理员
+	`UPDATE users SET role = 'admin' WHERE id = (SELECT id FROM users ORDER BY created_at LIMIT 1)`,
+	`CREATE TABLE personal_tokens (
+		id           TEXT PRIMARY KEY,
+		user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name         TEXT NOT NULL,
+		prefix       TEXT NOT NULL,
+		token_hash   TEXT NOT NULL UNIQUE,
+		scopes       TEXT NOT NULL,
+		created_at   INTEGER NOT NULL,
+		expires_at   INTEGER NOT NULL DEFAULT 0,
+		last_used_at INTEGER NOT NULL DEFAULT 0,
+		last_used_ip TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX personal_tokens_user_id ON personal_tokens (user_id)`,
+	`CREATE TABLE user_identities (
+		issuer     TEXT NOT NULL,
+		subject    TEXT NOT NULL,
+		user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (issuer, subject)
+	)`,
+	// 已删除用户的用户名，不再分配
+	`CREATE TABLE deleted_usernames (
+		username   TEXT PRIMARY KEY,
+		deleted_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE refresh_tokens (
+		token_hash TEXT PRIMARY KEY,
+		username   TEXT NOT NULL,
+		session    TEXT NOT NULL,
+		expires_at INTEGER NOT NULL,
+		used       INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX refresh_tokens_session ON refresh_tokens (session)`,
+	`CREATE INDEX refresh_tokens_username ON refresh_tokens (username)`,
+	`CREATE TABLE revocations (
+		kind       TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		before     INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY (kind, key)
+	)`,
+	`ALTER TABLE refresh_tokens ADD COLUMN auth_time INTEGER NOT NULL DEFAULT 0`,
+}
+
+// SQLite用户存储
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// 打开（不存在时创建）SQLite数据库并执行迁移，dsn为数据库文件路径
+func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path != "" && path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+		}
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	// SQLite同一时间只允许一个写入者，使用单连接避免SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) migrate() error {
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA foreign_keys = ON", "PRAGMA busy_timeout = 5000"} {
+		if _, err := s.db.Exec(pragma); err != nil {
+			return fmt.Errorf("初始化数据库失败: %w", err)
+		}
+	}
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("读取数据库版本失败: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("数据库迁移%d失败: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const userColumns = "id, username, password_hash, display_name, email, role, created_at, updated_at"
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	var u User
+	var created, updated int64
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.DisplayName, &u.Email, &u.Role, &created, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt = time.UnixMilli(created)
+	u.UpdatedAt = time.UnixMilli(updated)
+	return &u, nil
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, u *User) error {
+	return insertUser(ctx, s.db, u)
+}
+
+// 插入用户，db可以是连接或事务
+func insertUser(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, u *User) error {
+	if u.Role == "" {
+		u.Role = RoleEditor
+	}
+	now := time.Now()
+	res, err := db.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+") SELECT ?, ?, ?, ?, ?, ?, ?, ? "+
+			"WHERE NOT EXISTS (SELECT 1 FROM deleted_usernames WHERE username = ?)",
+		u.ID, u.Username, u.PasswordHash, u.DisplayName, u.Email, u.Role, now.UnixMilli(), now.UnixMilli(), u.Username)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
+			return ErrUsernameTaken
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUsernameTaken
+	}
+	u.CreatedAt, u.UpdatedAt = now, now
+	return nil
+}
+
+func (s *SQLiteStore) GetByID(ctx context.Context, id string) (*User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (s *SQLiteStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username = ?", username))
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]*User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, u *User) error {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE users SET password_hash = ?, display_name = ?, email = ?, role = ?, updated_at = ? WHERE id = ?",
+		u.PasswordHash, u.DisplayName, u.Email, u.Role, now.UnixMilli(), u.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	u.UpdatedAt = now
+	return nil
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// 外键级联依赖连接上的foreign_keys设置，这里显式删除
+	for _, table := range []string{"personal_tokens", "user_identities"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT OR IGNORE INTO deleted_usernames (username, deleted_at) SELECT username, ? FROM users WHERE id = ?",
+		time.Now().UnixMilli(), id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetByIdentity(ctx context.Context, issuer, subject string) (*User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = (SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?)",
+		issuer, subject))
+}
+
+func (s *SQLiteStore) CreateWithIdentity(ctx context.Context, u *User, issuer, subject string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertUser(ctx, tx, u); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO user_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (issuer, subject) DO UPDATE SET user_id = excluded.user_id",
+		issuer, subject, u.ID, u.CreatedAt.UnixMilli()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const tokenColumns = "id, user_id, name, prefix, token_hash, scopes, created_at, expires_at, last_used_at, last_used_ip"
+
+// 时间列以毫秒保存，0表示未设置
+func scanToken(row interface{ Scan(...any) error }) (*PersonalToken, error) {
+	var t PersonalToken
+	var scopes string
+	var created, expires, used int64
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Hash, &scopes, &created, &expires, &used, &t.LastUsedIP)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	t.CreatedAt = time.UnixMilli(created)
+	if expires != 0 {
+		exp := time.UnixMilli(expires)
+		t.ExpiresAt = &exp
+	}
+	if used != 0 {
+		at := time.UnixMilli(used)
+		t.LastUsedAt = &at
+	}
+	return &t, nil
+}
+
+func (s *SQLiteStore) CreateToken(ctx context.Context, t *PersonalToken) error {
+	now := time.Now()
+	var expires int64
+	if t.ExpiresAt != nil {
+		expires = t.ExpiresAt.UnixMilli()
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO personal_tokens (id, user_id, name, prefix, token_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		t.ID, t.UserID, t.Name, t.Prefix, t.Hash, strings.Join(t.Scopes, " "), now.UnixMilli(), expires)
+	if err != nil {
+		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	t.CreatedAt = now
+	return nil
+}
+
+func (s *SQLiteStore) GetTokenByHash(ctx context.Context, hash string) (*PersonalToken, error) {
+	return scanToken(s.db.QueryRowContext(ctx, "SELECT "+tokenColumns+" FROM personal_tokens WHERE token_hash = ?", hash))
+}
+
+func (s *SQLiteStore) ListTokens(ctx context.Context, userID string) ([]*PersonalToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+tokenColumns+" FROM personal_tokens WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*PersonalToken, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteToken(ctx context.Context, userID, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM personal_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) TouchToken(ctx context.Context, id string, at time.Time, ip string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE personal_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?", at.UnixMilli(), ip, id)
+	return err
+}
+
+func (s *SQLiteStore) CreateRefreshToken(ctx context.Context, t *RefreshToken) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, username, session, auth_time, expires_at, used) VALUES (?, ?, ?, ?, ?, ?)",
+		t.Hash, t.Username, t.Session, t.AuthTime.UnixMilli(), t.ExpiresAt.UnixMilli(), t.Used)
+	return err
+}
+
+func (s *SQLiteStore) UseRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	t := RefreshToken{Hash: hash}
+	var authTime, expires int64
+	err = tx.QueryRowContext(ctx, "SELECT username, session, auth_time, expires_at, used FROM refresh_tokens WHERE token_hash = ?", hash).
+		Scan(&t.Username, &t.Session, &authTime, &expires, &t.Used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.AuthTime = time.UnixMilli(authTime)
+	t.ExpiresAt = time.UnixMilli(expires)
+	if time.Now().After(t.ExpiresAt) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if !t.Used {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used = 1 WHERE token_hash = ?", hash); err != nil {
+			return nil, err
+		}
+	}
+	return &t, tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteSessionRefreshTokens(ctx context.Context, session string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE session = ?", session)
+	return err
+}
+
+func (s *SQLiteStore) DeleteUserRefreshTokens(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE username = ?", username)
+	return err
+}
+
+func (s *SQLiteStore) Revoke(ctx context.Context, r Revocation) error {
+	var before int64
+	if !r.Before.IsZero() {
+		before = r.Before.UnixMilli()
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO revocations (kind, key, before, expires_at) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (kind, key) DO UPDATE SET before = excluded.before, expires_at = excluded.expires_at",
+		r.Kind, r.Key, before, r.ExpiresAt.UnixMilli())
+	return err
+}
+
+func (s *SQLiteStore) Revoked(ctx context.Context, tokenID, session, username string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM revocations WHERE (kind = ? AND key = ?) OR (kind = ? AND key = ?) OR (kind = ? AND key = ? AND before > ?))",
+		RevokeToken, tokenID, RevokeSession, session, RevokeUser, username, issuedAt.UnixMilli()).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *SQLiteStore) PruneSessions(ctx context.Context, now time.Time) error {
+	for _, table := range []string{"refresh_tokens", "revocations"} {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at < ?", now.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,42 @@
+package account
+
+import (
+	"errors"
+	"time"
+)
+
+// 个人访问令牌的权限范围
+const (
+	ScopeDocumentsRead  = "documents:read"
+	ScopeDocumentsWrite = "documents:write"
+	ScopeAIInvoke       = "ai:invoke"
+)
+
+// 全部权限范围
+var Scopes = []string{ScopeDocumentsRead, ScopeDocumentsWrite, ScopeAIInvoke}
+
+// 权限范围是否有效
+func ValidScope(scope string) bool {
+	return scope == ScopeDocumentsRead || scope == ScopeDocumentsWrite || scope == ScopeAIInvoke
+}
+
+var ErrTokenNotFound = errors.New("令牌不存在")
+
+// 个人访问令牌，供脚本调用API。只保存令牌的哈希，明文仅在创建时返回一次
+type PersonalToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 令牌开头几位，便于辨认
+	Hash       string     `json:"-"`      // 令牌的SHA-256
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"` // 为空表示不过期
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+}
+
+// 令牌是否已过期
+func (t *PersonalToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
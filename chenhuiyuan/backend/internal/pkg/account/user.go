@@ -0,0 +1,97 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 用户角色：管理员可以修改全局设置和管理用户，编辑者可以使用全部写作功能，查看者只能读取
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// 角色是否有效
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleEditor || role == RoleViewer
+}
+
+var (
+	ErrUserNotFound  = errors.New("用户不存在")
+	ErrUsernameTaken = errors.New("用户已存在")
+)
+
+// 用户账号
+type User struct {
+	ID           string    `json:"id"` // UUID
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	DisplayName  string    `json:"displayName"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// 用户存储，返回的*User均为副本，修改后需调用Update保存
+type UserStore interface {
+	// 保存新用户，用户名已存在或属于已删除的用户时返回ErrUsernameTaken。未指定角色时为编辑者，
+	// 管理员只能由初始管理员配置创建或由其他管理员授予
+	Create(ctx context.Context, u *User) error
+	GetByID(ctx context.Context, id string) (*User, error)
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	// 全部用户，按创建时间排序
+	List(ctx context.Context) ([]*User, error)
+	// 按ID更新密码、资料和角色，用户名不可修改
+	Update(ctx context.Context, u *User) error
+	// 删除用户及其个人访问令牌和外部身份。用户名保留不再分配，
+	// 避免按用户名保存的数据被同名的新账号继承
+	Delete(ctx context.Context, id string) error
+
+	// 按单点登录身份（issuer和sub）查找已关联的用户，未关联时返回ErrUserNotFound
+	GetByIdentity(ctx context.Context, issuer, subject string) (*User, error)
+	// 保存新用户并关联单点登录身份，两者要么都完成要么都不生效。用户名规则同Create
+	CreateWithIdentity(ctx context.Context, u *User, issuer, subject string) error
+
+	// 保存新的个人访问令牌
+	CreateToken(ctx context.Context, t *PersonalToken) error
+	// 按令牌哈希查找，不存在时返回ErrTokenNotFound
+	GetTokenByHash(ctx context.Context, hash string) (*PersonalToken, error)
+	// 用户的全部令牌，按创建时间排序
+	ListTokens(ctx context.Context, userID string) ([]*PersonalToken, error)
+	// 删除用户的令牌，令牌不属于该用户时返回ErrTokenNotFound
+	DeleteToken(ctx context.Context, userID, id string) error
+	// 记录令牌最近一次使用的时间和来源IP
+	TouchToken(ctx context.Context, id string, at time.Time, ip string) error
+
+	// 保存新的刷新令牌
+	CreateRefreshToken(ctx context.Context, t *RefreshToken) error
+	// 把刷新令牌标记为已使用并返回标记前的记录，不存在或已过期时返回ErrRefreshTokenNotFound
+	UseRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+	// 删除会话的全部刷新令牌
+	DeleteSessionRefreshTokens(ctx context.Context, session string) error
+	// 删除用户的全部刷新令牌
+	DeleteUserRefreshTokens(ctx context.Context, username string) error
+	// 保存访问令牌注销记录，同类型同Key的记录已存在时覆盖
+	Revoke(ctx context.Context, r Revocation) error
+	// 访问令牌是否已被注销：令牌ID、所属会话或用户在签发时间之后的注销记录
+	Revoked(ctx context.Context, tokenID, session, username string, issuedAt time.Time) (bool, error)
+	// 清理过期的刷新令牌和注销记录
+	PruneSessions(ctx context.Context, now time.Time) error
+
+	Close() error
+}
+
+// 按驱动名创建用户存储：memory或sqlite
+func Open(driver, dsn string) (UserStore, error) {
+	switch driver {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "sqlite":
+		return NewSQLiteStore(dsn)
+	}
+	return nil, fmt.Errorf("不支持的数据库驱动: %s", driver)
+}
@@ -2,153 +2,292 @@ package ai
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"ai-writing-assistant/internal/pkg/config"
+	"ai-writing-assistant/internal/pkg/secrets"
 )
 
 // AI配置结构
 type AIConfig struct {
-	Server struct {
-		Port int    `yaml:"port"`
-		Host string `yaml:"host"`
-	} `yaml:"server"`
-	AI struct {
-		DefaultModel string      `yaml:"default_model"`
-		Tongyi       ModelConfig `yaml:"tongyi"`
-		DeepSeek     ModelConfig `yaml:"deepseek"`
-		Wenxin       ModelConfig `yaml:"wenxin"`
-		Zhipu        ModelConfig `yaml:"zhipu"`
+	Server ServerConfig `yaml:"server"`
+	AI     struct {
+		DefaultModel string           `yaml:"default_model" validate:"required"`
+		Tongyi       ModelConfig      `yaml:"tongyi"`
+		DeepSeek     ModelConfig      `yaml:"deepseek"`
+		Wenxin       ModelConfig      `yaml:"wenxin"`
+		Zhipu        ModelConfig      `yaml:"zhipu"`
+		Jobs         JobsConfig       `yaml:"jobs"`
+		Retrieval    RetrievalConfig  `yaml:"retrieval"`
+		Moderation   ModerationConfig `yaml:"moderation"`
+		Redaction    RedactionConfig  `yaml:"redaction"`
+		Health       HealthConfig     `yaml:"health"`
 	} `yaml:"ai"`
+	Auth     AuthConfig    `yaml:"auth"`
+	Secrets  SecretsConfig `yaml:"secrets"`
 	Database struct {
-		Driver string `yaml:"driver"`
-		DSN    string `yaml:"dsn"`
+		Driver string `yaml:"driver" validate:"oneof=memory sqlite"` // 用户账号存储，memory重启后丢失
+		DSN    string `yaml:"dsn"`                                   // sqlite为数据库文件路径
 	} `yaml:"database"`
-	Logging struct {
-		Level  string `yaml:"level"`
-		Format string `yaml:"format"`
-		Output string `yaml:"output"`
-	} `yaml:"logging"`
+	Logging LoggingConfig `yaml:"logging"`
+	Metrics MetricsConfig `yaml:"metrics"`
+}
+
+// Prometheus指标接口配置
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`             // 是否提供/metrics，修改后需要重启
+	Token   string `yaml:"token" secret:"true"` // 配置后抓取时需携带Authorization: Bearer <token>
+}
+
+// 日志配置，级别修改后重新加载即可生效，输出和格式需要重启
+type LoggingConfig struct {
+	Level    string `yaml:"level" validate:"oneof=debug info warn error"`
+	Format   string `yaml:"format" validate:"oneof=json text"`
+	Output   string `yaml:"output"` // stdout、stderr或日志文件路径
+	Rotation struct {
+		MaxSizeMB  int           `yaml:"max_size_mb" validate:"min=0"` // 日志文件超过该大小后轮转，0表示不轮转
+		MaxBackups int           `yaml:"max_backups" validate:"min=0"` // 保留的旧日志文件数，0表示不限制
+		MaxAge     time.Duration `yaml:"max_age" validate:"min=0s"`    // 旧日志文件的保留时长，0表示不限制
+	} `yaml:"rotation"`
+}
+
+// HTTP服务配置，超时为0表示不限制
+type ServerConfig struct {
+	Port              int           `yaml:"port" validate:"min=1,max=65535"`
+	Host              string        `yaml:"host"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" validate:"min=0s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" validate:"min=0s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" validate:"min=0s"` // 限制整个响应的写入时长，会截断较长的流式输出
+	IdleTimeout       time.Duration `yaml:"idle_timeout" validate:"min=0s"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" validate:"min=0s"` // 停止时等待进行中请求完成的最长时间
+	TrustedProxies    []string      `yaml:"trusted_proxies"`                    // 可信反向代理地址（IP或CIDR），只信任这些代理转发的X-Forwarded-For
+	TLS               struct {
+		CertFile string `yaml:"cert_file"` // 证书和私钥同时配置时启用HTTPS，文件更新后自动重新加载
+		KeyFile  string `yaml:"key_file"`
+	} `yaml:"tls"`
+}
+
+// 登录令牌配置
+type AuthConfig struct {
+	ActiveKey       string               `yaml:"active_key"`                          // 签发新令牌使用的密钥ID
+	Keys            []JWTKeyConfig       `yaml:"keys"`                                // 验证时按令牌头中的kid选择，轮换期间保留旧密钥
+	AccessTokenTTL  time.Duration        `yaml:"access_token_ttl" validate:"min=1m"`  // 访问令牌有效期
+	RefreshTokenTTL time.Duration        `yaml:"refresh_token_ttl" validate:"min=1m"` // 刷新令牌有效期，每次刷新后重新计算
+	Password        PasswordPolicyConfig `yaml:"password"`
+	Lockout         LockoutConfig        `yaml:"lockout"`
+	OIDC            OIDCConfig           `yaml:"oidc"`
+	InitialAdmin    InitialAdminConfig   `yaml:"initial_admin"`
+}
+
+// 初始管理员，启动时还没有任何管理员才会创建。自助注册和单点登录都不会创建管理员
+type InitialAdminConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"` // 需满足密码要求，创建后可以通过修改密码接口更换
+}
+
+// OIDC单点登录配置，使用授权码流程和PKCE
+type OIDCConfig struct {
+	Enabled         bool     `yaml:"enabled"`
+	Issuer          string   `yaml:"issuer" validate:"url"`                       // 身份提供者地址，从{issuer}/.well-known/openid-configuration读取端点
+	ClientID        string   `yaml:"client_id"`                                   // 在身份提供者处注册的客户端ID
+	ClientSecret    string   `yaml:"client_secret" secret:"true"`                 // 公开客户端可以不配置，仅依赖PKCE
+	RedirectURL     string   `yaml:"redirect_url" validate:"url"`                 // 回调地址，指向/api/auth/oidc/callback
+	Scopes          []string `yaml:"scopes"`                                      // 请求的scope，始终包含openid
+	UsernameClaim   string   `yaml:"username_claim"`                              // 作为本地用户名的ID令牌声明
+	AutoProvision   bool     `yaml:"auto_provision"`                              // 首次登录时自动创建本地用户
+	DefaultRole     string   `yaml:"default_role" validate:"oneof=editor viewer"` // 自动创建用户的角色，默认editor，不能是管理员
+	AllowedDomains  []string `yaml:"allowed_domains"`                             // 只允许这些邮箱域名的用户登录，为空不限制
+	SuccessRedirect string   `yaml:"success_redirect" validate:"url"`             // 登录成功后跳转的前端地址，令牌放在URL片段中；为空时返回JSON
+}
+
+// 密码强度要求，注册和修改密码时检查。字段与account.PasswordPolicy一一对应，可直接转换
+type PasswordPolicyConfig struct {
+	MinLength      int  `yaml:"min_length" validate:"min=1,max=72"`
+	MinClasses     int  `yaml:"min_classes" validate:"min=1,max=4"` // 至少包含几类字符：小写字母、大写字母、数字、符号
+	RejectUsername bool `yaml:"reject_username"`                    // 不能包含用户名
+	RejectCommon   bool `yaml:"reject_common"`                      // 拒绝常见弱密码
+}
+
+// 登录失败限制，按账号和来源IP分别计数
+type LockoutConfig struct {
+	Window           time.Duration `yaml:"window" validate:"min=1m"`           // 超过该时长没有新的失败后计数清零
+	FreeAttempts     int           `yaml:"free_attempts" validate:"min=0"`     // 同一账号不需要等待的失败次数
+	IPFreeAttempts   int           `yaml:"ip_free_attempts" validate:"min=0"`  // 同一IP不需要等待的失败次数，NAT后可能有多个用户
+	BaseDelay        time.Duration `yaml:"base_delay" validate:"min=0s"`       // 之后每次失败需等待的时间，逐次翻倍
+	MaxDelay         time.Duration `yaml:"max_delay" validate:"min=0s"`        // 等待时间上限
+	AccountThreshold int           `yaml:"account_threshold" validate:"min=1"` // 同一账号失败几次后锁定
+	IPThreshold      int           `yaml:"ip_threshold" validate:"min=1"`      // 同一IP失败几次后锁定
+	Duration         time.Duration `yaml:"duration" validate:"min=1m"`         // 锁定时长
+}
+
+// JWT签名密钥（HS256），至少32字节
+type JWTKeyConfig struct {
+	ID     string `yaml:"id" validate:"required"`
+	Secret string `yaml:"secret" secret:"true" validate:"required"`
+}
+
+// 密钥来源，配置中的"secret:<名称>"按名称从这里读取
+type SecretsConfig struct {
+	File string `yaml:"file"` // AES-256-GCM加密的密钥文件，主密钥来自环境变量SECRETS_MASTER_KEY
+	Dir  string `yaml:"dir"`  // 编排系统挂载的密钥目录，每个文件一个密钥，优先于加密文件
 }
 
 // 模型配置结构
 type ModelConfig struct {
-	APIKey      string  `yaml:"api_key"`
-	BaseURL     string  `yaml:"base_url"`
+	APIKey      string  `yaml:"api_key" secret:"true"`
+	BaseURL     string  `yaml:"base_url" validate:"url"`
 	Model       string  `yaml:"model"`
-	MaxTokens   int     `yaml:"max_tokens"`
-	Temperature float64 `yaml:"temperature"`
+	MaxTokens   int     `yaml:"max_tokens" validate:"min=0"`
+	Temperature float64 `yaml:"temperature" validate:"min=0,max=2"`
 }
 
-// 获取AI配置
-func GetAIConfig() *AIConfig {
-	// 从YAML配置文件读取
-	config := loadYAMLConfig()
+// 异步任务配置
+type JobsConfig struct {
+	Workers   int           `yaml:"workers" validate:"min=1"`    // 并发执行的worker数量
+	QueueSize int           `yaml:"queue_size" validate:"min=1"` // 等待队列容量，超出时拒绝提交
+	Timeout   time.Duration `yaml:"timeout" validate:"min=1s"`   // 单个任务的最长执行时间
+	Retention time.Duration `yaml:"retention" validate:"min=0s"` // 结束后结果保留时长
+}
 
-	// 如果YAML中没有配置，使用默认值
-	if config == nil {
-		fmt.Println("警告: 无法加载配置文件，使用默认配置")
-		config = getDefaultConfig()
-	}
+// 文档检索配置
+type RetrievalConfig struct {
+	TopK      int         `yaml:"top_k" validate:"min=0"`      // 注入提示词的参考片段数
+	MaxTokens int         `yaml:"max_tokens" validate:"min=0"` // 参考片段占用的最大token数
+	Embedding ModelConfig `yaml:"embedding"`                   // 向量模型（OpenAI兼容接口），未配置API密钥时仅使用BM25
+}
 
-	// 环境变量覆盖（优先级更高）
-	overrideWithEnvVars(config)
+// 敏感内容审核配置
+type ModerationConfig struct {
+	Enabled     bool             `yaml:"enabled"`
+	CheckInput  bool             `yaml:"check_input"`  // 审核发送给模型的内容
+	CheckOutput bool             `yaml:"check_output"` // 审核模型返回的内容
+	Lists       []WordListConfig `yaml:"lists"`
+}
 
-	return config
+// 敏感词表，Action为block（拦截）、mask（打码）或flag（仅记录）
+type WordListConfig struct {
+	Name   string   `yaml:"name" validate:"required"`
+	Action string   `yaml:"action" validate:"oneof=block mask flag"`
+	Words  []string `yaml:"words"`
+	File   string   `yaml:"file"` // 每行一个词，#开头为注释
 }
 
-// 从YAML文件加载配置
-func loadYAMLConfig() *AIConfig {
-	// 尝试多个可能的配置文件路径
-	configPaths := []string{
-		"configs/config.yaml",       // 相对于当前工作目录
-		"../configs/config.yaml",    // 相对于当前工作目录的上级
-		"../../configs/config.yaml", // 相对于当前工作目录的上上级
-		"./configs/config.yaml",     // 明确当前目录
-	}
+// 个人信息脱敏配置，作为用户未自定义时的默认策略
+type RedactionConfig struct {
+	Enabled   bool                `yaml:"enabled"`
+	Types     []string            `yaml:"types" validate:"oneof=phone idcard email name"` // phone、idcard、email、name
+	Functions map[string][]string `yaml:"functions"`                                      // 按功能覆盖脱敏类型，空列表表示该功能不脱敏
+}
 
-	var configData []byte
-	var configPath string
-	var err error
+// 提供者健康探测配置
+type HealthConfig struct {
+	Interval         time.Duration `yaml:"interval" validate:"min=1s"`         // 探测间隔
+	Timeout          time.Duration `yaml:"timeout" validate:"min=100ms"`       // 单次探测超时
+	FailureThreshold int           `yaml:"failure_threshold" validate:"min=1"` // 连续失败几次后标记为不健康
+	Window           int           `yaml:"window" validate:"min=1"`            // 统计延迟百分位的最近探测次数
+}
 
-	// 尝试读取配置文件
-	for _, path := range configPaths {
-		configData, err = os.ReadFile(path)
-		if err == nil {
-			configPath = path
-			break
-		}
-	}
+// 获取当前生效的AI配置，首次调用时加载配置文件
+func GetAIConfig() *AIConfig {
+	return DefaultConfigManager().Current()
+}
 
-	// 如果所有路径都失败，尝试从可执行文件所在目录查找
-	if configData == nil {
-		execPath, execErr := os.Executable()
-		if execErr == nil {
-			execDir := filepath.Dir(execPath)
-			execConfigPath := filepath.Join(execDir, "configs", "config.yaml")
-			configData, err = os.ReadFile(execConfigPath)
-			if err == nil {
-				configPath = execConfigPath
-			}
-		}
+// 按选项加载配置：在默认配置之上依次叠加配置文件，再应用环境变量覆盖、解析密钥引用并校验。
+// 返回实际加载的文件列表（含密钥文件），出错时也尽量返回以便监视其变化
+func LoadConfig(opts config.Options) (*AIConfig, []string, error) {
+	files, err := config.Files(opts)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// 如果仍然找不到配置文件，返回nil
-	if configData == nil {
-		fmt.Printf("错误: 无法找到配置文件，尝试过的路径: %v\n", configPaths)
-		return nil
+	cfg := getDefaultConfig()
+	if err := config.Load(files, cfg); err != nil {
+		return nil, files, err
 	}
+	overrideWithEnvVars(cfg)
 
-	fmt.Printf("成功加载配置文件: %s\n", configPath)
-
-	// 替换环境变量占位符
-	configData = replaceEnvPlaceholders(configData)
-
-	var config AIConfig
-	if err := yaml.Unmarshal(configData, &config); err != nil {
-		fmt.Printf("错误: 解析配置文件失败: %v\n", err)
-		fmt.Printf("配置文件内容:\n%s\n", string(configData))
-		return nil
+	store, secretFiles, err := secrets.Open(secrets.Sources{
+		File:      cfg.Secrets.File,
+		Dir:       cfg.Secrets.Dir,
+		MasterKey: os.Getenv(secrets.MasterKeyEnv),
+	})
+	files = append(files, secretFiles...)
+	if err != nil {
+		return nil, files, fmt.Errorf("读取密钥失败: %w", err)
 	}
-
-	return &config
+	resolveSecrets(cfg, store)
+	if err := config.Validate(cfg); err != nil {
+		return nil, files, err
+	}
+	return cfg, files, nil
 }
 
-// 替换环境变量占位符
-func replaceEnvPlaceholders(data []byte) []byte {
-	content := string(data)
-
-	// 替换常见的环境变量占位符
-	replacements := map[string]string{
-		"${TONGYI_API_KEY}":    os.Getenv("TONGYI_API_KEY"),
-		"${TONGYI_BASE_URL}":   os.Getenv("TONGYI_BASE_URL"),
-		"${DEEPSEEK_API_KEY}":  os.Getenv("DEEPSEEK_API_KEY"),
-		"${DEEPSEEK_BASE_URL}": os.Getenv("DEEPSEEK_BASE_URL"),
-		"${WENXIN_API_KEY}":    os.Getenv("WENXIN_API_KEY"),
-		"${WENXIN_BASE_URL}":   os.Getenv("WENXIN_BASE_URL"),
-		"${ZHIPU_API_KEY}":     os.Getenv("ZHIPU_API_KEY"),
-		"${ZHIPU_BASE_URL}":    os.Getenv("ZHIPU_BASE_URL"),
-	}
-
-	for placeholder, value := range replacements {
-		if value == "" {
-			// 如果环境变量为空，使用空字符串（不带引号）
-			content = strings.ReplaceAll(content, placeholder, "")
-		} else {
-			content = strings.ReplaceAll(content, placeholder, value)
+// 把密钥字段中的"secret:<名称>"替换为密钥值，并登记全部密钥以便在日志和响应中隐藏。
+// 引用的密钥不存在时视为未配置（值为空），与未设置的环境变量一致
+func resolveSecrets(cfg *AIConfig, store *secrets.Store) {
+	var missing []string
+	config.WalkSecrets(cfg, func(path string, value *string) error {
+		name, ok := secrets.ParseRef(*value)
+		if !ok {
+			secrets.Track(path, *value)
+			return nil
+		}
+		v, found := store.Get(name)
+		if !found {
+			missing = append(missing, name)
 		}
+		*value = v
+		secrets.Track(name, v)
+		return nil
+	})
+	if len(missing) > 0 {
+		slog.Warn("以下密钥不存在，按未配置处理", "secrets", missing)
 	}
-
-	return []byte(content)
 }
 
 // 获取默认配置
 func getDefaultConfig() *AIConfig {
 	var config AIConfig
+	config.Server.Port = 8080
+	config.Server.Host = "0.0.0.0"
+	config.Server.ReadHeaderTimeout = 10 * time.Second
+	config.Server.ReadTimeout = time.Minute
+	config.Server.IdleTimeout = 2 * time.Minute
+	config.Server.ShutdownTimeout = 30 * time.Second
+	config.Database.Driver = "memory"
+	config.Logging.Level = "info"
+	config.Logging.Format = "json"
+	config.Logging.Output = "stdout"
+	config.Logging.Rotation.MaxSizeMB = 100
+	config.Logging.Rotation.MaxBackups = 7
+	config.Logging.Rotation.MaxAge = 30 * 24 * time.Hour
+	config.Metrics.Enabled = true
 	config.AI.DefaultModel = "mock"
+	config.Auth.AccessTokenTTL = 15 * time.Minute
+	config.Auth.RefreshTokenTTL = 7 * 24 * time.Hour
+	config.Auth.OIDC = OIDCConfig{
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: "preferred_username",
+		AutoProvision: true,
+	}
+	config.Auth.Password = PasswordPolicyConfig{
+		MinLength:      8,
+		MinClasses:     2,
+		RejectUsername: true,
+		RejectCommon:   true,
+	}
+	config.Auth.Lockout = LockoutConfig{
+		Window:           15 * time.Minute,
+		FreeAttempts:     3,
+		IPFreeAttempts:   20,
+		BaseDelay:        time.Second,
+		MaxDelay:         30 * time.Second,
+		AccountThreshold: 10,
+		IPThreshold:      50,
+		Duration:         15 * time.Minute,
+	}
 	config.AI.Tongyi = ModelConfig{
 		APIKey:      "",
 		BaseURL:     "https://dashscope.aliyuncs.com/api/v1/services/aigc/text-generation/generation",
@@ -177,6 +316,30 @@ func getDefaultConfig() *AIConfig {
 		MaxTokens:   2000,
 		Temperature: 0.7,
 	}
+	config.AI.Jobs = JobsConfig{
+		Workers:   4,
+		QueueSize: 100,
+		Timeout:   10 * time.Minute,
+		Retention: time.Hour,
+	}
+	config.AI.Redaction = RedactionConfig{
+		Enabled: true,
+		Types:   []string{"phone", "idcard", "email", "name"},
+	}
+	config.AI.Health = HealthConfig{
+		Interval:         30 * time.Second,
+		Timeout:          5 * time.Second,
+		FailureThreshold: 2,
+		Window:           50,
+	}
+	config.AI.Retrieval = RetrievalConfig{
+		TopK:      4,
+		MaxTokens: 1000,
+		Embedding: ModelConfig{
+			BaseURL: "https://dashscope.aliyuncs.com/compatible-mode/v1/embeddings",
+			Model:   "text-embedding-v3",
+		},
+	}
 	return &config
 }
 
@@ -218,6 +381,20 @@ func overrideWithEnvVars(config *AIConfig) {
 	if env := os.Getenv("ZHIPU_BASE_URL"); env != "" {
 		config.AI.Zhipu.BaseURL = env
 	}
+
+	// 未配置签名密钥时使用JWT_SECRET
+	if env := os.Getenv("JWT_SECRET"); env != "" && len(config.Auth.Keys) == 0 {
+		config.Auth.Keys = []JWTKeyConfig{{ID: "default", Secret: env}}
+		config.Auth.ActiveKey = "default"
+	}
+
+	// 文档检索向量模型
+	if env := os.Getenv("EMBEDDING_API_KEY"); env != "" {
+		config.AI.Retrieval.Embedding.APIKey = env
+	}
+	if env := os.Getenv("EMBEDDING_BASE_URL"); env != "" {
+		config.AI.Retrieval.Embedding.BaseURL = env
+	}
 }
 
 // 获取环境变量，如果不存在则返回默认值
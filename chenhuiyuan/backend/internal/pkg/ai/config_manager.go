@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/config"
+	"ai-writing-assistant/internal/pkg/logging"
+)
+
+// 配置管理器：启动时加载一次，之后监视配置文件变化或收到SIGHUP时重新加载。
+// 新配置通过全部校验后才会替换当前配置并通知订阅者，校验失败时继续使用旧配置
+type ConfigManager struct {
+	current atomic.Pointer[AIConfig]
+
+	mu         sync.Mutex // 串行化重新加载
+	opts       config.Options
+	files      []string             // 已加载的配置文件，基础配置在前，之后为密钥文件
+	modTimes   map[string]time.Time // 已加载的文件及其修改时间
+	validators []func(*AIConfig) error
+	listeners  []func(old, cfg *AIConfig)
+}
+
+var (
+	defaultManagerMu sync.Mutex
+	defaultManager   *ConfigManager
+)
+
+// 按选项加载配置并设为全局配置管理器，需在首次使用配置前调用。
+// 找不到配置文件时使用默认配置，配置有误时返回错误
+func InitConfig(opts config.Options) (*ConfigManager, error) {
+	m := &ConfigManager{opts: opts}
+	err := m.load()
+	if errors.Is(err, config.ErrNotFound) {
+		slog.Warn(err.Error() + "，使用默认配置")
+		cfg := getDefaultConfig()
+		overrideWithEnvVars(cfg)
+		m.current.Store(cfg)
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if files := m.Files(); len(files) > 0 {
+		slog.Info("成功加载配置文件", "files", files)
+	}
+
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+	defaultManager = m
+	return m, nil
+}
+
+// 全局配置管理器，未调用InitConfig时按APP_ENV指定的运行环境加载默认位置的配置文件
+func DefaultConfigManager() *ConfigManager {
+	defaultManagerMu.Lock()
+	m := defaultManager
+	defaultManagerMu.Unlock()
+	if m != nil {
+		return m
+	}
+	m, err := InitConfig(config.Options{Profile: os.Getenv("APP_ENV")})
+	if err != nil {
+		logging.Fatal("加载配置失败", logging.Err(err))
+	}
+	return m
+}
+
+// 当前生效的配置，调用方不应修改返回值
+func (m *ConfigManager) Current() *AIConfig {
+	return m.current.Load()
+}
+
+// 注册校验函数，重新加载时任一校验失败则放弃本次加载
+func (m *ConfigManager) OnValidate(fn func(*AIConfig) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validators = append(m.validators, fn)
+}
+
+// 注册配置变更回调，在新配置生效后按注册顺序调用
+func (m *ConfigManager) OnChange(fn func(old, cfg *AIConfig)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// 重新加载配置文件
+func (m *ConfigManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.modTimes == nil {
+		return errors.New("未找到配置文件，无法重新加载")
+	}
+	old := m.current.Load()
+	if err := m.load(); err != nil {
+		return err
+	}
+	cfg := m.current.Load()
+	for _, fn := range m.listeners {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+// 读取、校验并替换当前配置，调用方需持有m.mu（初次加载除外）
+func (m *ConfigManager) load() error {
+	cfg, files, err := LoadConfig(m.opts)
+	if files != nil {
+		// 加载失败时同样记录修改时间，避免反复加载同一份有问题的文件
+		m.files = files
+		m.modTimes = make(map[string]time.Time, len(files))
+		for _, f := range files {
+			m.modTimes[f] = modTime(f)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, validate := range m.validators {
+		if err := validate(cfg); err != nil {
+			return fmt.Errorf("配置校验失败: %w", err)
+		}
+	}
+	m.current.Store(cfg)
+	return nil
+}
+
+// 文件的修改时间，文件不存在时为零值
+func modTime(path string) time.Time {
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// 已加载的配置文件和密钥文件
+func (m *ConfigManager) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.files)
+}
+
+// 配置文件或密钥在上次加载后是否被修改（含新增的环境配置文件）
+func (m *ConfigManager) changed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.modTimes == nil {
+		return false
+	}
+	files, err := config.Files(m.opts)
+	if err != nil {
+		return false
+	}
+	for _, f := range files {
+		if _, ok := m.modTimes[f]; !ok {
+			return true
+		}
+	}
+	for f, t := range m.modTimes {
+		if !modTime(f).Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// 在后台监视配置文件：每隔interval检查修改时间，收到SIGHUP时立即重新加载，ctx结束后停止
+func (m *ConfigManager) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				m.reloadAndLog("收到SIGHUP")
+			case <-ticker.C:
+				if m.changed() {
+					m.reloadAndLog("配置文件已修改")
+				}
+			}
+		}
+	}()
+}
+
+func (m *ConfigManager) reloadAndLog(reason string) {
+	if err := m.Reload(); err != nil {
+		slog.Error(reason+"，重新加载配置失败，继续使用原配置", logging.Err(err))
+		return
+	}
+	slog.Info(reason+"，已重新加载配置文件", "files", m.Files())
+}
@@ -9,7 +9,10 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
 )
 
 // DeepSeek配置
@@ -45,8 +48,25 @@ type ResponseFormat struct {
 }
 
 type DeepSeekMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string             `json:"role"`
+	Content    string             `json:"content"`
+	ToolCalls  []DeepSeekToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string             `json:"tool_call_id,omitempty"`
+}
+
+// 工具定义与工具调用（OpenAI兼容格式）
+type DeepSeekTool struct {
+	Type     string         `json:"type"`
+	Function ToolDefinition `json:"function"`
+}
+
+type DeepSeekToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
 }
 
 // DeepSeek响应结构
@@ -56,12 +76,9 @@ type DeepSeekResponse struct {
 	Created int64  `json:"created"`
 	Model   string `json:"model"`
 	Choices []struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
+		Index        int             `json:"index"`
+		Message      DeepSeekMessage `json:"message"`
+		FinishReason string          `json:"finish_reason"`
 	} `json:"choices"`
 	Usage struct {
 		PromptTokens     int `json:"prompt_tokens"`
@@ -93,6 +110,7 @@ type DeepSeekStreamResponse struct {
 
 // 对话历史管理
 type ConversationHistory struct {
+	mu       sync.Mutex
 	Messages []DeepSeekMessage
 	MaxSize  int
 }
@@ -105,6 +123,8 @@ func NewConversationHistory(maxSize int) *ConversationHistory {
 }
 
 func (ch *ConversationHistory) AddMessage(role, content string) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
 	message := DeepSeekMessage{Role: role, Content: content}
 	ch.Messages = append(ch.Messages, message)
 
@@ -115,10 +135,14 @@ func (ch *ConversationHistory) AddMessage(role, content string) {
 }
 
 func (ch *ConversationHistory) GetMessages() []DeepSeekMessage {
-	return ch.Messages
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]DeepSeekMessage(nil), ch.Messages...)
 }
 
 func (ch *ConversationHistory) Clear() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
 	ch.Messages = make([]DeepSeekMessage, 0)
 }
 
@@ -126,15 +150,15 @@ func (ch *ConversationHistory) Clear() {
 type DeepSeekProvider struct {
 	config DeepSeekConfig
 	client *http.Client
+	// 调用方未设置截止时间时的默认超时
+	timeout time.Duration
 	// 为每个用户/会话维护对话历史
+	mu            sync.Mutex
 	conversations map[string]*ConversationHistory
 }
 
 // 创建DeepSeek提供者
-func NewDeepSeekProvider() *DeepSeekProvider {
-	// 使用配置管理系统
-	config := GetAIConfig().AI.DeepSeek
-
+func NewDeepSeekProvider(config ModelConfig) *DeepSeekProvider {
 	return &DeepSeekProvider{
 		config: DeepSeekConfig{
 			APIKey:      config.APIKey,
@@ -143,9 +167,8 @@ func NewDeepSeekProvider() *DeepSeekProvider {
 			MaxTokens:   config.MaxTokens,
 			Temperature: config.Temperature,
 		},
-		client: &http.Client{
-			Timeout: 60 * time.Second, // DeepSeek可能需要更长时间
-		},
+		client:        logging.NewClient(0),
+		timeout:       60 * time.Second, // DeepSeek可能需要更长时间
 		conversations: make(map[string]*ConversationHistory),
 	}
 }
@@ -172,6 +195,101 @@ func (d *DeepSeekProvider) Chat(ctx context.Context, message, sessionID string)
 	return d.chat(ctx, message, sessionID)
 }
 
+// 支持工具调用的多轮对话，对话历史中只保存用户消息和最终回答
+func (d *DeepSeekProvider) ChatWithTools(ctx context.Context, message, sessionID string, tools *ToolRegistry, opts ToolOptions) (string, error) {
+	if !d.IsAvailable() {
+		return "", fmt.Errorf("DeepSeek API未配置")
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, d.timeout)
+	defer cancel()
+
+	conversation := d.getConversation(sessionID)
+	conversation.AddMessage("user", message)
+
+	history := conversation.GetMessages()
+	messages := make([]ChatMessage, 0, len(history))
+	for _, m := range history {
+		messages = append(messages, ChatMessage{Role: m.Role, Content: m.Content})
+	}
+
+	result, err := RunToolLoop(ctx, d.completeWithTools, messages, tools, opts)
+	if err != nil {
+		return "", err
+	}
+	conversation.AddMessage("assistant", result)
+	return result, nil
+}
+
+// 单轮工具调用请求
+func (d *DeepSeekProvider) completeWithTools(ctx context.Context, messages []ChatMessage, tools []ToolDefinition) (ChatMessage, error) {
+	request := DeepSeekRequest{
+		Model:       d.config.Model,
+		Messages:    make([]DeepSeekMessage, 0, len(messages)),
+		MaxTokens:   d.config.MaxTokens,
+		Temperature: d.config.Temperature,
+		TopP:        1.0,
+		ToolChoice:  "none",
+	}
+	for _, m := range messages {
+		msg := DeepSeekMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			tc := DeepSeekToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name, tc.Function.Arguments = call.Name, call.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		request.Messages = append(request.Messages, msg)
+	}
+	if len(tools) > 0 {
+		request.ToolChoice = "auto"
+		for _, t := range tools {
+			request.Tools = append(request.Tools, DeepSeekTool{Type: "function", Function: t})
+		}
+	}
+
+	response, err := d.send(ctx, request)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	reply := response.Choices[0].Message
+	msg := ChatMessage{Role: "assistant", Content: reply.Content}
+	for _, tc := range reply.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+	}
+	return msg, nil
+}
+
+// 以JSON模式调用，模型保证输出合法的JSON对象
+func (d *DeepSeekProvider) CompleteJSON(ctx context.Context, systemPrompt, prompt string) (string, error) {
+	if !d.IsAvailable() {
+		return "", fmt.Errorf("DeepSeek API未配置")
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx, d.timeout)
+	defer cancel()
+
+	request := DeepSeekRequest{
+		Model: d.config.Model,
+		Messages: []DeepSeekMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:   d.config.MaxTokens,
+		Temperature: d.config.Temperature,
+		TopP:        1.0,
+		ResponseFormat: &ResponseFormat{
+			Type: "json_object",
+		},
+		ToolChoice: "none",
+	}
+
+	response, err := d.send(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
 func (d *DeepSeekProvider) GetModelInfo() ModelInfo {
 	return ModelInfo{
 		Name:        "deepseek-chat",
@@ -187,8 +305,31 @@ func (d *DeepSeekProvider) IsAvailable() bool {
 	return d.config.APIKey != ""
 }
 
+// 查询模型列表作为健康探测，不消耗token，同时能发现API密钥失效
+func (d *DeepSeekProvider) HealthCheck(ctx context.Context) error {
+	url := strings.TrimSuffix(d.config.BaseURL, "/chat/completions") + "/models"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+d.config.APIKey)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API请求失败: %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // 获取或创建对话历史
 func (d *DeepSeekProvider) getConversation(sessionID string) *ConversationHistory {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if conversation, exists := d.conversations[sessionID]; exists {
 		return conversation
 	}
@@ -204,6 +345,9 @@ func (d *DeepSeekProvider) chat(ctx context.Context, message, sessionID string)
 		return "", fmt.Errorf("DeepSeek API未配置")
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx, d.timeout)
+	defer cancel()
+
 	conversation := d.getConversation(sessionID)
 
 	// 添加用户消息到对话历史
@@ -228,42 +372,9 @@ func (d *DeepSeekProvider) chat(ctx context.Context, message, sessionID string)
 		TopLogprobs: nil,
 	}
 
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", d.config.BaseURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+d.config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := d.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	response, err := d.send(ctx, request)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API请求失败: %d - %s", resp.StatusCode, string(body))
-	}
-
-	var response DeepSeekResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
-	}
-
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("API返回结果为空")
+		return "", err
 	}
 
 	// 添加AI回复到对话历史
@@ -279,6 +390,9 @@ func (d *DeepSeekProvider) callAIStream(ctx context.Context, function, content,
 		return fmt.Errorf("DeepSeek API未配置")
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx, d.timeout)
+	defer cancel()
+
 	// 构建提示词
 	var systemPrompt string
 	switch function {
@@ -325,10 +439,11 @@ func (d *DeepSeekProvider) callAIStream(ctx context.Context, function, content,
 		ResponseFormat: &ResponseFormat{
 			Type: "text",
 		},
-		Stop:        nil,
-		ToolChoice:  "none",
-		Logprobs:    false,
-		TopLogprobs: nil,
+		Stop:          nil,
+		StreamOptions: map[string]bool{"include_usage": true}, // 最后一个数据块返回token用量
+		ToolChoice:    "none",
+		Logprobs:      false,
+		TopLogprobs:   nil,
 	}
 
 	jsonData, err := json.Marshal(request)
@@ -380,6 +495,14 @@ func (d *DeepSeekProvider) callAIStream(ctx context.Context, function, content,
 				continue // 忽略解析错误，继续处理下一行
 			}
 
+			if streamResp.Usage != nil {
+				recordUsage(ctx, TokenUsage{
+					PromptTokens:     streamResp.Usage.PromptTokens,
+					CompletionTokens: streamResp.Usage.CompletionTokens,
+					TotalTokens:      streamResp.Usage.TotalTokens,
+				})
+			}
+
 			// 提取内容并写入
 			if len(streamResp.Choices) > 0 && streamResp.Choices[0].Delta.Content != "" {
 				content := streamResp.Choices[0].Delta.Content
@@ -393,12 +516,20 @@ func (d *DeepSeekProvider) callAIStream(ctx context.Context, function, content,
 		}
 	}
 
-	// 如果有会话ID，将AI回复添加到对话历史
-	if sessionID != "" {
+	// 如果有会话ID，将AI回复添加到对话历史（被取消时保留已生成的部分）
+	if sessionID != "" && fullResponse.Len() > 0 {
 		conversation := d.getConversation(sessionID)
 		conversation.AddMessage("assistant", fullResponse.String())
 	}
 
+	// 客户端断开或生成被取消时，读取会因context失效而中断
+	if err := scanner.Err(); err != nil {
+		if ctxErr := context.Cause(ctx); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("读取流式响应失败: %w", err)
+	}
+
 	return nil
 }
 
@@ -408,6 +539,9 @@ func (d *DeepSeekProvider) callAI(ctx context.Context, function, content, sessio
 		return "", fmt.Errorf("DeepSeek API未配置")
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx, d.timeout)
+	defer cancel()
+
 	// 构建提示词
 	var systemPrompt string
 	switch function {
@@ -460,14 +594,30 @@ func (d *DeepSeekProvider) callAI(ctx context.Context, function, content, sessio
 		TopLogprobs: nil,
 	}
 
+	response, err := d.send(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	// 如果有会话ID，将AI回复添加到对话历史
+	if sessionID != "" {
+		conversation := d.getConversation(sessionID)
+		conversation.AddMessage("assistant", response.Choices[0].Message.Content)
+	}
+
+	return response.Choices[0].Message.Content, nil
+}
+
+// 发送非流式请求并解析响应
+func (d *DeepSeekProvider) send(ctx context.Context, request DeepSeekRequest) (*DeepSeekResponse, error) {
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", d.config.BaseURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+d.config.APIKey)
@@ -476,33 +626,32 @@ func (d *DeepSeekProvider) callAI(ctx context.Context, function, content, sessio
 
 	resp, err := d.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("请求失败: %w", err)
+		return nil, fmt.Errorf("请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
+		return nil, fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API请求失败: %d - %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("API请求失败: %d - %s", resp.StatusCode, string(body))
 	}
 
 	var response DeepSeekResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
 
 	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("API返回结果为空")
+		return nil, fmt.Errorf("API返回结果为空")
 	}
+	recordUsage(ctx, TokenUsage{
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+	})
 
-	// 如果有会话ID，将AI回复添加到对话历史
-	if sessionID != "" {
-		conversation := d.getConversation(sessionID)
-		conversation.AddMessage("assistant", response.Choices[0].Message.Content)
-	}
-
-	return response.Choices[0].Message.Content, nil
+	return &response, nil
 }
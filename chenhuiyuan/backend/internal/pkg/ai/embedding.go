@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
+)
+
+// 单次请求最多提交的文本条数
+const embeddingBatchSize = 16
+
+// OpenAI兼容的向量请求结构（通义千问兼容模式、智谱等均支持）
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OpenAI兼容的向量响应结构
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// 文本向量客户端
+type EmbeddingClient struct {
+	config  ModelConfig
+	client  *http.Client
+	timeout time.Duration
+}
+
+// 创建文本向量客户端，未配置API密钥时返回nil
+func NewEmbeddingClient(config ModelConfig) *EmbeddingClient {
+	if config.APIKey == "" || config.BaseURL == "" {
+		return nil
+	}
+	return &EmbeddingClient{
+		config:  config,
+		client:  logging.NewClient(0),
+		timeout: 30 * time.Second,
+	}
+}
+
+// 计算一组文本的向量，结果与输入顺序一致
+func (e *EmbeddingClient) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(texts))
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *EmbeddingClient) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	ctx, cancel := withDefaultTimeout(ctx, e.timeout)
+	defer cancel()
+
+	jsonData, err := json.Marshal(embeddingRequest{Model: e.config.Model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.config.BaseURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+e.config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API请求失败: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response embeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("向量数量不匹配: 期望%d，实际%d", len(texts), len(response.Data))
+	}
+	recordUsage(ctx, TokenUsage{
+		PromptTokens: response.Usage.PromptTokens,
+		TotalTokens:  response.Usage.TotalTokens,
+	})
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("向量序号越界: %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
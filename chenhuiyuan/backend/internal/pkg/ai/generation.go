@@ -0,0 +1,197 @@
+package ai
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 生成被用户主动取消时作为context的取消原因
+var ErrGenerationCancelled = errors.New("生成已被取消")
+
+var (
+	ErrGenerationNotFound = errors.New("生成任务不存在")
+	ErrGenerationFinished = errors.New("生成任务已结束")
+)
+
+// 生成任务状态
+type GenerationStatus string
+
+const (
+	GenerationRunning   GenerationStatus = "running"
+	GenerationCompleted GenerationStatus = "completed"
+	GenerationCancelled GenerationStatus = "cancelled"
+	GenerationFailed    GenerationStatus = "failed"
+)
+
+// 生成任务快照
+type GenerationInfo struct {
+	ID           string           `json:"id"`
+	Owner        string           `json:"-"`
+	FunctionType string           `json:"functionType"`
+	ModelName    string           `json:"modelName"`
+	Status       GenerationStatus `json:"status"`
+	Output       string           `json:"output"`
+	Error        string           `json:"error,omitempty"`
+	StartedAt    time.Time        `json:"startedAt"`
+	FinishedAt   *time.Time       `json:"finishedAt,omitempty"`
+}
+
+// 一次进行中的AI生成，实现io.Writer以记录已生成的部分内容
+type Generation struct {
+	mu     sync.Mutex
+	info   GenerationInfo
+	output strings.Builder
+	cancel context.CancelCauseFunc
+}
+
+func (g *Generation) ID() string { return g.info.ID }
+
+func (g *Generation) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.output.Write(p)
+	return len(p), nil
+}
+
+// 结束生成并记录最终状态，取消原因优先于err
+func (g *Generation) Finish(ctx context.Context, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.info.Status != GenerationRunning {
+		return
+	}
+	now := time.Now()
+	g.info.FinishedAt = &now
+	switch {
+	case errors.Is(context.Cause(ctx), ErrGenerationCancelled):
+		g.info.Status = GenerationCancelled
+	case err != nil:
+		g.info.Status = GenerationFailed
+		g.info.Error = err.Error()
+	default:
+		g.info.Status = GenerationCompleted
+	}
+	g.cancel(nil)
+}
+
+func (g *Generation) Snapshot() GenerationInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	info := g.info
+	info.Output = g.output.String()
+	return info
+}
+
+// 生成任务注册表，结束的任务保留retention时长以便查询部分输出
+type GenerationRegistry struct {
+	mu        sync.Mutex
+	items     map[string]*Generation
+	retention time.Duration
+}
+
+func NewGenerationRegistry(retention time.Duration) *GenerationRegistry {
+	return &GenerationRegistry{
+		items:     make(map[string]*Generation),
+		retention: retention,
+	}
+}
+
+// 登记一次新的生成，返回的context在请求结束或被取消时失效
+func (r *GenerationRegistry) Start(ctx context.Context, owner, functionType, modelName string) (*Generation, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	g := &Generation{
+		info: GenerationInfo{
+			ID:           newGenerationID(),
+			Owner:        owner,
+			FunctionType: functionType,
+			ModelName:    modelName,
+			Status:       GenerationRunning,
+			StartedAt:    time.Now(),
+		},
+		cancel: cancel,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune()
+	r.items[g.info.ID] = g
+	return g, ctx
+}
+
+// 查询属于owner的生成任务
+func (r *GenerationRegistry) Get(id, owner string) (GenerationInfo, error) {
+	r.mu.Lock()
+	g, ok := r.items[id]
+	r.mu.Unlock()
+	if !ok || g.info.Owner != owner {
+		return GenerationInfo{}, ErrGenerationNotFound
+	}
+	return g.Snapshot(), nil
+}
+
+// 取消属于owner的生成任务，返回取消时已生成的内容
+func (r *GenerationRegistry) Cancel(id, owner string) (GenerationInfo, error) {
+	r.mu.Lock()
+	g, ok := r.items[id]
+	r.mu.Unlock()
+	if !ok || g.info.Owner != owner {
+		return GenerationInfo{}, ErrGenerationNotFound
+	}
+
+	g.mu.Lock()
+	if g.info.Status != GenerationRunning {
+		g.mu.Unlock()
+		return g.Snapshot(), ErrGenerationFinished
+	}
+	now := time.Now()
+	g.info.Status = GenerationCancelled
+	g.info.FinishedAt = &now
+	g.cancel(ErrGenerationCancelled)
+	g.mu.Unlock()
+
+	return g.Snapshot(), nil
+}
+
+// 取消并删除owner的全部生成任务，用于删除账号
+func (r *GenerationRegistry) Purge(owner string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, g := range r.items {
+		if g.info.Owner != owner {
+			continue
+		}
+		g.mu.Lock()
+		if g.info.Status == GenerationRunning {
+			now := time.Now()
+			g.info.Status = GenerationCancelled
+			g.info.FinishedAt = &now
+			g.cancel(ErrGenerationCancelled)
+		}
+		g.mu.Unlock()
+		delete(r.items, id)
+	}
+}
+
+// 清理过期的已结束任务，调用方需持有锁
+func (r *GenerationRegistry) prune() {
+	cutoff := time.Now().Add(-r.retention)
+	for id, g := range r.items {
+		g.mu.Lock()
+		expired := g.info.FinishedAt != nil && g.info.FinishedAt.Before(cutoff)
+		g.mu.Unlock()
+		if expired {
+			delete(r.items, id)
+		}
+	}
+}
+
+func newGenerationID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "gen_" + hex.EncodeToString(b)
+}
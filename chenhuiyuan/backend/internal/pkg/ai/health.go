@@ -0,0 +1,245 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 提供者健康状态
+const (
+	HealthUnknown   = "unknown"   // 尚未探测
+	HealthHealthy   = "healthy"   // 最近一次探测成功
+	HealthDegraded  = "degraded"  // 最近探测失败，但连续失败次数未达到阈值
+	HealthUnhealthy = "unhealthy" // 连续失败达到阈值或未配置，拒绝选用
+)
+
+var ErrProviderUnhealthy = errors.New("模型暂不可用")
+
+// 支持主动探测的提供者，应使用不消耗token的轻量请求（如查询模型列表）
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// 包装其他提供者的提供者（如审核、脱敏），探测时需要找到最内层的实现
+type Unwrapper interface {
+	Unwrap() Provider
+}
+
+// 探测提供者是否可用：沿包装链查找HealthChecker，都未实现时以IsAvailable为准
+func CheckHealth(ctx context.Context, p Provider) error {
+	if !p.IsAvailable() {
+		return errors.New("未配置API密钥")
+	}
+	for cur := p; cur != nil; {
+		if hc, ok := cur.(HealthChecker); ok {
+			return hc.HealthCheck(ctx)
+		}
+		u, ok := cur.(Unwrapper)
+		if !ok {
+			break
+		}
+		cur = u.Unwrap()
+	}
+	return nil
+}
+
+// 健康状态，延迟统计基于最近若干次成功的探测
+type HealthStatus struct {
+	Status              string    `json:"status"`
+	Reachable           bool      `json:"reachable"`
+	LastCheck           time.Time `json:"lastCheck,omitzero"`
+	LastSuccess         time.Time `json:"lastSuccess,omitzero"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LatencyP50          int64     `json:"latencyP50Ms"`
+	LatencyP95          int64     `json:"latencyP95Ms"`
+	LatencyP99          int64     `json:"latencyP99Ms"`
+}
+
+type providerHealth struct {
+	status    HealthStatus
+	latencies []time.Duration // 环形缓冲
+	next      int
+}
+
+// 定期探测所有已注册提供者的健康监控
+type HealthMonitor struct {
+	cfg  HealthConfig
+	mu   sync.Mutex
+	byID map[string]*providerHealth
+	stop context.CancelFunc
+}
+
+func newHealthMonitor() *HealthMonitor {
+	return &HealthMonitor{
+		cfg:  HealthConfig{Interval: 30 * time.Second, Timeout: 5 * time.Second, FailureThreshold: 2, Window: 50},
+		byID: make(map[string]*providerHealth),
+	}
+}
+
+func (m *HealthMonitor) get(name string) *providerHealth {
+	h, ok := m.byID[name]
+	if !ok {
+		h = &providerHealth{status: HealthStatus{Status: HealthUnknown}}
+		m.byID[name] = h
+	}
+	return h
+}
+
+// 记录一次探测结果
+func (m *HealthMonitor) record(name string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.get(name)
+	now := time.Now()
+	h.status.LastCheck = now
+	if err != nil {
+		h.status.Reachable = false
+		h.status.LastError = err.Error()
+		h.status.ConsecutiveFailures++
+		if h.status.ConsecutiveFailures >= m.cfg.FailureThreshold {
+			h.status.Status = HealthUnhealthy
+		} else {
+			h.status.Status = HealthDegraded
+		}
+		return
+	}
+
+	h.status.Reachable = true
+	h.status.LastSuccess = now
+	h.status.ConsecutiveFailures = 0
+	h.status.Status = HealthHealthy
+	window := m.cfg.Window
+	if len(h.latencies) < window {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+		h.next = (h.next + 1) % window
+	}
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	h.status.LatencyP50 = percentile(sorted, 50).Milliseconds()
+	h.status.LatencyP95 = percentile(sorted, 95).Milliseconds()
+	h.status.LatencyP99 = percentile(sorted, 99).Milliseconds()
+}
+
+// 最近秩法计算百分位
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (p*len(sorted)+99)/100 - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// 提供者被替换后重新开始统计
+func (m *HealthMonitor) reset(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.byID, name)
+}
+
+func (m *HealthMonitor) status(name string) HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(name).status
+}
+
+// 探测一个提供者并记录结果
+func (m *HealthMonitor) probe(ctx context.Context, name string, p Provider) {
+	m.mu.Lock()
+	timeout := m.cfg.Timeout
+	m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := CheckHealth(ctx, p)
+	m.record(name, time.Since(start), err)
+}
+
+// 开始定期探测所有已注册的提供者，启动时立即探测一轮
+func (s *Service) StartHealthChecks(cfg HealthConfig) {
+	m := s.health
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	if cfg.Interval > 0 {
+		m.cfg.Interval = cfg.Interval
+	}
+	if cfg.Timeout > 0 {
+		m.cfg.Timeout = cfg.Timeout
+	}
+	if cfg.FailureThreshold > 0 {
+		m.cfg.FailureThreshold = cfg.FailureThreshold
+	}
+	if cfg.Window > 0 {
+		m.cfg.Window = cfg.Window
+	}
+	interval := m.cfg.Interval
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stop = cancel
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.ProbeAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// 停止定期探测
+func (s *Service) StopHealthChecks() {
+	m := s.health
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		m.stop()
+		m.stop = nil
+	}
+}
+
+// 并发探测所有提供者一轮
+func (s *Service) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, p := range s.snapshot() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.health.probe(ctx, name, p)
+		}()
+	}
+	wg.Wait()
+}
+
+// 提供者的实时健康状态
+func (s *Service) Health(name string) HealthStatus {
+	return s.health.status(name)
+}
+
+// 检查提供者能否被选用，不健康时返回ErrProviderUnhealthy
+func (s *Service) CheckAvailable(name string) error {
+	p := s.Provider(name)
+	if p == nil {
+		return fmt.Errorf("%w: 模型不存在", ErrProviderUnhealthy)
+	}
+	if !p.IsAvailable() {
+		return fmt.Errorf("%w: 未配置API密钥", ErrProviderUnhealthy)
+	}
+	if st := s.health.status(name); st.Status == HealthUnhealthy {
+		return fmt.Errorf("%w: %s", ErrProviderUnhealthy, st.LastError)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/metrics"
+)
+
+var (
+	providerRequests = metrics.NewCounterVec("ai_provider_requests_total",
+		"模型调用次数，status为ok、error或cancelled", "model", "function", "status")
+	providerDuration = metrics.NewHistogramVec("ai_provider_request_duration_seconds",
+		"模型调用耗时（流式调用到输出结束）", metrics.DefaultBuckets, "model", "function")
+	timeToFirstToken = metrics.NewHistogramVec("ai_stream_time_to_first_token_seconds",
+		"流式调用从发起到收到第一段输出的时间", metrics.DefaultBuckets, "model", "function")
+	streamDuration = metrics.NewHistogramVec("ai_stream_duration_seconds",
+		"流式调用从第一段输出到结束的时间", metrics.DefaultBuckets, "model", "function")
+	activeStreams = metrics.NewGaugeVec("ai_active_streams",
+		"进行中的流式调用数", "model")
+	tokensUsed = metrics.NewCounterVec("ai_tokens_total",
+		"上游返回的token用量，type为prompt或completion", "model", "function", "type")
+)
+
+// 为提供者加上调用日志和指标：每次调用记录模型、功能、耗时、token用量和错误，
+// 日志中的用户和请求ID来自ctx
+func instrument(name string, p Provider) Provider {
+	w := &instrumentedProvider{Provider: p, name: name}
+	if _, ok := p.(ToolChatter); ok {
+		return &instrumentedToolProvider{w}
+	}
+	return w
+}
+
+type instrumentedProvider struct {
+	Provider
+	name string
+}
+
+// 供健康探测找到被包装的提供者
+func (p *instrumentedProvider) Unwrap() Provider {
+	return p.Provider
+}
+
+// 开始一次调用，返回的函数在调用结束时记录日志和指标
+func (p *instrumentedProvider) begin(ctx context.Context, function string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, usage := WithUsageRecorder(ctx)
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+		status := "ok"
+		switch {
+		case errors.Is(err, context.Canceled):
+			status = "cancelled"
+		case err != nil:
+			status = "error"
+		}
+		providerRequests.Inc(p.name, function, status)
+		providerDuration.Observe(elapsed.Seconds(), p.name, function)
+		u := usage.Usage()
+		tokensUsed.Add(float64(u.PromptTokens), p.name, function, "prompt")
+		tokensUsed.Add(float64(u.CompletionTokens), p.name, function, "completion")
+
+		attrs := []slog.Attr{
+			slog.String("model", p.name),
+			slog.String("function", function),
+			slog.Int64("latency_ms", elapsed.Milliseconds()),
+			slog.Int("prompt_tokens", u.PromptTokens),
+			slog.Int("completion_tokens", u.CompletionTokens),
+		}
+		level := slog.LevelInfo
+		if err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, logging.Err(err))
+		}
+		slog.LogAttrs(ctx, level, "模型调用", attrs...)
+	}
+}
+
+func (p *instrumentedProvider) ContinueWriting(ctx context.Context, prompt string) (string, error) {
+	ctx, done := p.begin(ctx, "continue")
+	out, err := p.Provider.ContinueWriting(ctx, prompt)
+	done(err)
+	return out, err
+}
+
+func (p *instrumentedProvider) PolishText(ctx context.Context, text string) (string, error) {
+	ctx, done := p.begin(ctx, "polish")
+	out, err := p.Provider.PolishText(ctx, text)
+	done(err)
+	return out, err
+}
+
+func (p *instrumentedProvider) SummarizeText(ctx context.Context, text string) (string, error) {
+	ctx, done := p.begin(ctx, "summarize")
+	out, err := p.Provider.SummarizeText(ctx, text)
+	done(err)
+	return out, err
+}
+
+func (p *instrumentedProvider) CallAIStream(ctx context.Context, function, content, sessionID string, writer io.Writer) error {
+	ctx, done := p.begin(ctx, function)
+	activeStreams.Inc(p.name)
+	defer activeStreams.Dec(p.name)
+
+	w := &firstTokenWriter{Writer: writer, start: time.Now()}
+	err := p.Provider.CallAIStream(ctx, function, content, sessionID, w)
+	if first := w.firstAt(); !first.IsZero() {
+		timeToFirstToken.Observe(first.Sub(w.start).Seconds(), p.name, function)
+		streamDuration.Observe(time.Since(first).Seconds(), p.name, function)
+	}
+	done(err)
+	return err
+}
+
+func (p *instrumentedProvider) Chat(ctx context.Context, message, sessionID string) (string, error) {
+	ctx, done := p.begin(ctx, "chat")
+	out, err := p.Provider.Chat(ctx, message, sessionID)
+	done(err)
+	return out, err
+}
+
+// 保留被包装提供者的JSON模式，不支持时由CompleteJSON退化为普通调用
+func (p *instrumentedProvider) CompleteJSON(ctx context.Context, systemPrompt, prompt string) (string, error) {
+	ctx, done := p.begin(ctx, "json")
+	out, err := CompleteJSON(ctx, p.Provider, systemPrompt, prompt)
+	done(err)
+	return out, err
+}
+
+// 支持工具调用的提供者
+type instrumentedToolProvider struct {
+	*instrumentedProvider
+}
+
+func (p *instrumentedToolProvider) ChatWithTools(ctx context.Context, message, sessionID string, tools *ToolRegistry, opts ToolOptions) (string, error) {
+	ctx, done := p.begin(ctx, "chat_tools")
+	out, err := p.Provider.(ToolChatter).ChatWithTools(ctx, message, sessionID, tools, opts)
+	done(err)
+	return out, err
+}
+
+// 记录第一段非空输出的时间
+type firstTokenWriter struct {
+	io.Writer
+	start time.Time
+
+	mu    sync.Mutex
+	first time.Time
+}
+
+func (w *firstTokenWriter) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		w.mu.Lock()
+		if w.first.IsZero() {
+			w.first = time.Now()
+		}
+		w.mu.Unlock()
+	}
+	return w.Writer.Write(b)
+}
+
+func (w *firstTokenWriter) firstAt() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.first
+}
@@ -3,6 +3,8 @@ package ai
 import (
 	"context"
 	"io"
+	"sync"
+	"time"
 )
 
 // AI模型信息
@@ -13,6 +15,8 @@ type ModelInfo struct {
 	Description string `json:"description"`
 	MaxTokens   int    `json:"maxTokens"`
 	IsAvailable bool   `json:"isAvailable"`
+
+	Health *HealthStatus `json:"health,omitempty"` // 实时健康状态，仅在模型列表中返回
 }
 
 // AI提供者接口
@@ -33,38 +37,132 @@ type Provider interface {
 	IsAvailable() bool
 }
 
-// AI服务
+// AI服务，提供者可在运行中被替换，已取得旧提供者的调用不受影响
 type Service struct {
+	mu        sync.RWMutex
 	providers map[string]Provider
 	current   string
 	models    []ModelInfo
+	health    *HealthMonitor
 }
 
 func NewService() *Service {
 	return &Service{
 		providers: make(map[string]Provider),
 		models:    make([]ModelInfo, 0),
+		health:    newHealthMonitor(),
 	}
 }
 
+// 注册提供者，同名提供者已存在时替换之并重置其健康状态。
+// 注册的提供者会加上调用日志和指标
 func (s *Service) Register(name string, p Provider) {
-	s.providers[name] = p
-	s.models = append(s.models, p.GetModelInfo())
+	s.RegisterAll([]NamedProvider{{Name: name, Provider: p}})
+}
+
+// 带注册名的提供者
+type NamedProvider struct {
+	Name     string
+	Provider Provider
 }
 
-func (s *Service) Use(name string) { s.current = name }
+// 同时注册多个提供者，在同一次加锁中完成替换，请求不会取到新旧混合的提供者
+func (s *Service) RegisterAll(providers []NamedProvider) {
+	wrapped := make([]Provider, len(providers))
+	for i, np := range providers {
+		wrapped[i] = instrument(np.Name, np.Provider)
+	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, np := range providers {
+		p := wrapped[i]
+		info := p.GetModelInfo()
+		if _, ok := s.providers[np.Name]; ok {
+			for k, m := range s.models {
+				if m.Provider == np.Name {
+					s.models[k] = info
+				}
+			}
+			s.health.reset(np.Name)
+		} else {
+			s.models = append(s.models, info)
+		}
+		s.providers[np.Name] = p
+	}
+}
+
+func (s *Service) Use(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = name
+}
+
+// 模型列表，可用状态结合配置和最近的健康探测结果实时计算
 func (s *Service) GetAvailableModels() []ModelInfo {
-	return s.models
+	s.mu.RLock()
+	registered := append([]ModelInfo(nil), s.models...)
+	s.mu.RUnlock()
+
+	models := make([]ModelInfo, 0, len(registered))
+	for _, m := range registered {
+		health := s.Health(m.Provider)
+		m.IsAvailable = s.CheckAvailable(m.Provider) == nil
+		m.Health = &health
+		models = append(models, m)
+	}
+	return models
 }
 
 func (s *Service) GetCurrentModel() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.current
 }
 
+// 按注册名获取提供者
+func (s *Service) Provider(name string) Provider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.providers[name]
+}
+
+// 根据模型名查找对应提供者的注册名
+func (s *Service) ResolveModel(modelName string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, model := range s.models {
+		if model.Name == modelName {
+			return model.Provider, true
+		}
+	}
+	return "", false
+}
+
 func (s *Service) CurrentProvider() Provider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if p, ok := s.providers[s.current]; ok {
 		return p
 	}
 	return nil
 }
+
+// 已注册提供者的快照
+func (s *Service) snapshot() map[string]Provider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	providers := make(map[string]Provider, len(s.providers))
+	for name, p := range s.providers {
+		providers[name] = p
+	}
+	return providers
+}
+
+// 调用方未设置截止时间时使用默认超时，异步任务等长时调用可通过context自行设置更长的截止时间
+func withDefaultTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
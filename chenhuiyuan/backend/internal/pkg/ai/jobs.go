@@ -0,0 +1,386 @@
+package ai
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
+	"ai-writing-assistant/internal/pkg/metrics"
+)
+
+var (
+	ErrQueueFull   = errors.New("任务队列已满，请稍后重试")
+	ErrQueueClosed = errors.New("任务队列已关闭")
+	ErrJobNotFound = errors.New("任务不存在")
+	ErrJobFinished = errors.New("任务已结束")
+)
+
+// 异步任务状态
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+func (s JobStatus) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// 异步任务的输入，Prompt由调用方预先构建
+type JobSpec struct {
+	Provider     string
+	FunctionType string
+	Prompt       string
+	SessionID    string
+}
+
+// 任务快照
+type JobInfo struct {
+	ID           string     `json:"id"`
+	FunctionType string     `json:"functionType"`
+	Provider     string     `json:"provider"`
+	Status       JobStatus  `json:"status"`
+	Result       string     `json:"result"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// 异步任务，实现io.Writer以便直接接收流式输出
+type Job struct {
+	mu        sync.Mutex
+	info      JobInfo
+	owner     string
+	spec      JobSpec
+	logCtx    context.Context // 提交请求的日志字段（请求ID、用户），不随请求结束而取消
+	output    strings.Builder
+	cancel    context.CancelFunc
+	cancelled bool
+	// 每次状态或输出变化时关闭并替换，用于通知订阅者
+	changed chan struct{}
+}
+
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.output.Write(p)
+	j.notify()
+	return len(p), nil
+}
+
+func (j *Job) Snapshot() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.snapshot()
+}
+
+// 获取offset之后的新增输出和当前快照，返回的channel在下一次变化时关闭
+func (j *Job) Watch(offset int) (string, JobInfo, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := j.output.String()
+	var delta string
+	if offset < len(out) {
+		delta = out[offset:]
+	}
+	return delta, j.snapshot(), j.changed
+}
+
+func (j *Job) snapshot() JobInfo {
+	info := j.info
+	info.Result = j.output.String()
+	return info
+}
+
+func (j *Job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// 标记任务开始执行，任务在排队期间已被取消时返回false
+func (j *Job) start(cancel context.CancelFunc) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancelled {
+		return false
+	}
+	now := time.Now()
+	j.info.Status = JobRunning
+	j.info.StartedAt = &now
+	j.cancel = cancel
+	j.notify()
+	return true
+}
+
+func (j *Job) finish(ctx context.Context, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.info.FinishedAt = &now
+	switch {
+	case j.cancelled:
+		j.info.Status = JobCancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		j.info.Status = JobFailed
+		j.info.Error = "任务执行超时"
+	case err != nil:
+		j.info.Status = JobFailed
+		j.info.Error = err.Error()
+	default:
+		j.info.Status = JobSucceeded
+	}
+	j.notify()
+
+	attrs := []slog.Attr{
+		slog.String("job_id", j.info.ID),
+		slog.String("model", j.info.Provider),
+		slog.String("function", j.info.FunctionType),
+		slog.String("status", string(j.info.Status)),
+		slog.Int64("latency_ms", now.Sub(*j.info.StartedAt).Milliseconds()),
+	}
+	level := slog.LevelInfo
+	if j.info.Error != "" {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", j.info.Error))
+	}
+	slog.LogAttrs(j.logCtx, level, "异步任务结束", attrs...)
+}
+
+// 基于固定数量worker的异步任务队列
+type JobQueue struct {
+	svc   *Service
+	cfg   JobsConfig
+	queue chan *Job
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	closed bool
+}
+
+// 创建任务队列并启动worker，未配置的参数使用默认值
+func NewJobQueue(svc *Service, cfg JobsConfig) *JobQueue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Minute
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = time.Hour
+	}
+
+	q := &JobQueue{
+		svc:   svc,
+		cfg:   cfg,
+		queue: make(chan *Job, cfg.QueueSize),
+		jobs:  make(map[string]*Job),
+	}
+	q.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// 提交任务，队列已满时立即返回ErrQueueFull。ctx只用于日志字段，任务不会随之取消
+func (q *JobQueue) Submit(ctx context.Context, owner string, spec JobSpec) (JobInfo, error) {
+	job := &Job{
+		info: JobInfo{
+			ID:           newJobID(),
+			FunctionType: spec.FunctionType,
+			Provider:     spec.Provider,
+			Status:       JobQueued,
+			CreatedAt:    time.Now(),
+		},
+		owner:   owner,
+		spec:    spec,
+		changed: make(chan struct{}),
+	}
+	job.logCtx = logging.CopyAttrs(context.Background(), ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return JobInfo{}, ErrQueueClosed
+	}
+	q.prune()
+	select {
+	case q.queue <- job:
+	default:
+		metrics.RateLimitRejections.Inc("job_queue")
+		return JobInfo{}, ErrQueueFull
+	}
+	q.jobs[job.info.ID] = job
+	return job.Snapshot(), nil
+}
+
+// 获取属于owner的任务
+func (q *JobQueue) Get(id, owner string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok || job.owner != owner {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// 列出owner的全部任务，按创建时间倒序
+func (q *JobQueue) List(owner string) []JobInfo {
+	q.mu.Lock()
+	list := make([]JobInfo, 0)
+	for _, job := range q.jobs {
+		if job.owner == owner {
+			list = append(list, job.Snapshot())
+		}
+	}
+	q.mu.Unlock()
+
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.After(list[k].CreatedAt) })
+	return list
+}
+
+// 取消排队中或执行中的任务
+func (q *JobQueue) Cancel(id, owner string) (JobInfo, error) {
+	job, err := q.Get(id, owner)
+	if err != nil {
+		return JobInfo{}, err
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if !job.abort() {
+		return job.snapshot(), ErrJobFinished
+	}
+	return job.snapshot(), nil
+}
+
+// 取消并删除owner的全部任务，用于删除账号
+func (q *JobQueue) Purge(owner string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, job := range q.jobs {
+		if job.owner != owner {
+			continue
+		}
+		job.mu.Lock()
+		job.abort()
+		job.mu.Unlock()
+		delete(q.jobs, id)
+	}
+}
+
+// 标记任务为已取消，任务已结束或已取消时返回false，调用方需持有j.mu
+func (j *Job) abort() bool {
+	if j.info.Status.Finished() || j.cancelled {
+		return false
+	}
+	j.cancelled = true
+	if j.cancel != nil {
+		// 执行中的任务由worker在调用返回后记录最终状态
+		j.cancel()
+	} else {
+		now := time.Now()
+		j.info.Status = JobCancelled
+		j.info.FinishedAt = &now
+		j.notify()
+	}
+	return true
+}
+
+// 停止接收新任务，并等待已提交的任务执行完毕
+func (q *JobQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.queue)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// 停止接收新任务并等待已提交的任务执行完毕，ctx结束时取消剩余任务后返回ctx的错误
+func (q *JobQueue) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	for _, job := range q.jobs {
+		job.mu.Lock()
+		job.abort()
+		job.mu.Unlock()
+	}
+	q.mu.Unlock()
+	<-done
+	return ctx.Err()
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+	for job := range q.queue {
+		q.run(job)
+	}
+}
+
+func (q *JobQueue) run(job *Job) {
+	ctx, cancel := context.WithTimeout(job.logCtx, q.cfg.Timeout)
+	defer cancel()
+	if !job.start(cancel) {
+		return
+	}
+
+	var err error
+	if p := q.svc.Provider(job.spec.Provider); p == nil {
+		err = fmt.Errorf("模型 %s 未注册", job.spec.Provider)
+	} else {
+		err = p.CallAIStream(ctx, job.spec.FunctionType, job.spec.Prompt, job.spec.SessionID, job)
+	}
+	job.finish(ctx, err)
+}
+
+// 清理超过保留时长的已结束任务，调用方需持有锁
+func (q *JobQueue) prune() {
+	cutoff := time.Now().Add(-q.cfg.Retention)
+	for id, job := range q.jobs {
+		job.mu.Lock()
+		expired := job.info.FinishedAt != nil && job.info.FinishedAt.Before(cutoff)
+		job.mu.Unlock()
+		if expired {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "job_" + hex.EncodeToString(b)
+}
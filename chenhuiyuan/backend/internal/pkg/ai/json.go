@@ -0,0 +1,36 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// 支持JSON输出模式（response_format为json_object）的提供者
+type JSONCompleter interface {
+	CompleteJSON(ctx context.Context, systemPrompt, prompt string) (string, error)
+}
+
+// 要求模型输出JSON对象：提供者支持JSON模式时直接使用，
+// 否则退化为普通调用并从输出中提取JSON部分
+func CompleteJSON(ctx context.Context, p Provider, systemPrompt, prompt string) (string, error) {
+	if jc, ok := p.(JSONCompleter); ok {
+		return jc.CompleteJSON(ctx, systemPrompt, prompt)
+	}
+
+	var buf strings.Builder
+	if err := p.CallAIStream(ctx, "json", systemPrompt+"\n\n"+prompt, "", &buf); err != nil {
+		return "", err
+	}
+	return ExtractJSON(buf.String())
+}
+
+// 从模型输出中提取JSON对象，兼容```json代码块和前后多余的说明文字
+func ExtractJSON(text string) (string, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return "", errors.New("模型输出中未找到JSON对象")
+	}
+	return text[start : end+1], nil
+}
@@ -3,33 +3,58 @@ package ai
 import (
 	"context"
 	"io"
+	"strings"
+	"unicode/utf8"
 )
 
 type MockProvider struct{}
 
 func (m MockProvider) ContinueWriting(ctx context.Context, prompt string) (string, error) {
-	return "[mock continue] " + prompt, nil
+	return mockReply(ctx, "[mock continue] ", prompt), nil
 }
 
 func (m MockProvider) PolishText(ctx context.Context, text string) (string, error) {
-	return "[mock polish] " + text, nil
+	return mockReply(ctx, "[mock polish] ", text), nil
 }
 
 func (m MockProvider) SummarizeText(ctx context.Context, text string) (string, error) {
-	return "[mock summary] " + text, nil
+	return mockReply(ctx, "[mock summary] ", text), nil
 }
 
 // 新增：流式AI调用接口
 func (m MockProvider) CallAIStream(ctx context.Context, function, content, sessionID string, writer io.Writer) error {
 	// 模拟流式返回
-	mockResponse := "[mock " + function + "] " + content
+	mockResponse := mockReply(ctx, "[mock "+function+"] ", content)
 	writer.Write([]byte(mockResponse))
 	return nil
 }
 
 // 新增：多轮对话接口
 func (m MockProvider) Chat(ctx context.Context, message, sessionID string) (string, error) {
-	return "[mock chat] " + message, nil
+	return mockReply(ctx, "[mock chat] ", message), nil
+}
+
+// 模拟工具调用：用户消息中提到某个工具名时调用该工具一次，再根据结果作答
+func (m MockProvider) ChatWithTools(ctx context.Context, message, sessionID string, tools *ToolRegistry, opts ToolOptions) (string, error) {
+	complete := func(ctx context.Context, messages []ChatMessage, defs []ToolDefinition) (ChatMessage, error) {
+		last := messages[len(messages)-1]
+		if last.Role == "user" {
+			for _, def := range defs {
+				if strings.Contains(last.Content, def.Name) {
+					call := ToolCall{ID: "call_mock_" + def.Name, Name: def.Name, Arguments: "{}"}
+					return ChatMessage{Role: "assistant", ToolCalls: []ToolCall{call}}, nil
+				}
+			}
+		}
+		return ChatMessage{Role: "assistant", Content: mockReply(ctx, "[mock chat] ", last.Content)}, nil
+	}
+	return RunToolLoop(ctx, complete, []ChatMessage{{Role: "user", Content: message}}, tools, opts)
+}
+
+// 模拟JSON模式调用，返回空对象
+func (m MockProvider) CompleteJSON(ctx context.Context, systemPrompt, prompt string) (string, error) {
+	mockReply(ctx, "", prompt)
+	return "{}", nil
 }
 
 func (m MockProvider) GetModelInfo() ModelInfo {
@@ -46,3 +71,11 @@ func (m MockProvider) GetModelInfo() ModelInfo {
 func (m MockProvider) IsAvailable() bool {
 	return true
 }
+
+// 拼接模拟回复，并按字符数记录模拟的token用量
+func mockReply(ctx context.Context, prefix, input string) string {
+	reply := prefix + input
+	in, out := utf8.RuneCountInString(input), utf8.RuneCountInString(reply)
+	recordUsage(ctx, TokenUsage{PromptTokens: in, CompletionTokens: out, TotalTokens: in + out})
+	return reply
+}
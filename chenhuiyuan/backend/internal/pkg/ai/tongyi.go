@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
 )
 
 // 通义千问配置
@@ -56,20 +58,21 @@ type Choice struct {
 }
 
 type Usage struct {
-	TotalTokens int `json:"total_tokens"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
 }
 
 // 通义千问提供者
 type TongyiProvider struct {
 	config TongyiConfig
 	client *http.Client
+	// 调用方未设置截止时间时的默认超时
+	timeout time.Duration
 }
 
 // 创建通义千问提供者
-func NewTongyiProvider() *TongyiProvider {
-	// 使用配置管理系统
-	config := GetAIConfig().AI.Tongyi
-
+func NewTongyiProvider(config ModelConfig) *TongyiProvider {
 	return &TongyiProvider{
 		config: TongyiConfig{
 			APIKey:      config.APIKey,
@@ -78,9 +81,8 @@ func NewTongyiProvider() *TongyiProvider {
 			MaxTokens:   config.MaxTokens,
 			Temperature: config.Temperature,
 		},
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client:  logging.NewClient(0),
+		timeout: 30 * time.Second,
 	}
 }
 
@@ -134,6 +136,9 @@ func (t *TongyiProvider) callAI(ctx context.Context, function, content string) (
 		return "", fmt.Errorf("通义千问API未配置")
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx, t.timeout)
+	defer cancel()
+
 	// 构建提示词
 	var systemPrompt string
 	switch function {
@@ -198,6 +203,11 @@ func (t *TongyiProvider) callAI(ctx context.Context, function, content string) (
 	if len(response.Output.Choices) == 0 {
 		return "", fmt.Errorf("API返回结果为空")
 	}
+	recordUsage(ctx, TokenUsage{
+		PromptTokens:     response.Usage.InputTokens,
+		CompletionTokens: response.Usage.OutputTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+	})
 
 	return response.Output.Choices[0].Message.Content, nil
 }
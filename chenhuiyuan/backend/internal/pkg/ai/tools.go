@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 未指定时工具调用的最大轮数
+const defaultToolSteps = 5
+
+var ErrToolNotFound = errors.New("工具不存在")
+
+// 工具定义，Parameters为JSON Schema
+type ToolDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// 模型发起的一次工具调用，Arguments为JSON字符串
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// 工具调用过程中的对话消息
+type ChatMessage struct {
+	Role       string
+	Content    string
+	ToolCalls  []ToolCall // assistant消息中的工具调用
+	ToolCallID string     // tool消息对应的调用ID
+}
+
+// 工具的执行函数，返回值序列化为JSON后交给模型
+type ToolHandler func(ctx context.Context, args json.RawMessage) (any, error)
+
+// 服务端工具注册表
+type ToolRegistry struct {
+	defs     []ToolDefinition
+	handlers map[string]ToolHandler
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{handlers: make(map[string]ToolHandler)}
+}
+
+func (r *ToolRegistry) Register(def ToolDefinition, h ToolHandler) {
+	r.defs = append(r.defs, def)
+	r.handlers[def.Name] = h
+}
+
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	return r.defs
+}
+
+// 执行一次工具调用，返回JSON格式的结果
+func (r *ToolRegistry) Execute(ctx context.Context, call ToolCall) (string, error) {
+	h, ok := r.handlers[call.Name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrToolNotFound, call.Name)
+	}
+	args := json.RawMessage(call.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return "", fmt.Errorf("工具参数不是合法的JSON")
+	}
+	result, err := h(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("序列化工具结果失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// 工具调用事件：tool_call为模型发起调用，tool_result为执行结果
+type ToolEvent struct {
+	Type       string `json:"type"`
+	Step       int    `json:"step"`
+	ToolCallID string `json:"toolCallId"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments,omitempty"`
+	Result     string `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// 工具调用选项
+type ToolOptions struct {
+	MaxSteps int             // 最多进行几轮工具调用，超出后要求模型直接回答
+	OnEvent  func(ToolEvent) // 工具调用事件回调，可为nil
+}
+
+// 支持工具调用的多轮对话，提供者可选实现
+type ToolChatter interface {
+	ChatWithTools(ctx context.Context, message, sessionID string, tools *ToolRegistry, opts ToolOptions) (string, error)
+}
+
+// 单轮模型调用，tools为nil时要求模型不再调用工具
+type CompleteFunc func(ctx context.Context, messages []ChatMessage, tools []ToolDefinition) (ChatMessage, error)
+
+// 循环调用模型并执行其发起的工具调用，直到模型给出最终回答或达到轮数上限
+func RunToolLoop(ctx context.Context, complete CompleteFunc, messages []ChatMessage, tools *ToolRegistry, opts ToolOptions) (string, error) {
+	maxSteps := opts.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultToolSteps
+	}
+	emit := func(ev ToolEvent) {
+		if opts.OnEvent != nil {
+			opts.OnEvent(ev)
+		}
+	}
+
+	for step := 1; step <= maxSteps; step++ {
+		reply, err := complete(ctx, messages, tools.Definitions())
+		if err != nil {
+			return "", err
+		}
+		if len(reply.ToolCalls) == 0 {
+			return reply.Content, nil
+		}
+
+		messages = append(messages, reply)
+		for _, call := range reply.ToolCalls {
+			emit(ToolEvent{Type: "tool_call", Step: step, ToolCallID: call.ID, Name: call.Name, Arguments: call.Arguments})
+			result, err := tools.Execute(ctx, call)
+			ev := ToolEvent{Type: "tool_result", Step: step, ToolCallID: call.ID, Name: call.Name, Result: result}
+			if err != nil {
+				// 执行失败的原因交给模型，由模型决定如何继续
+				ev.Error = err.Error()
+				data, _ := json.Marshal(map[string]string{"error": err.Error()})
+				result = string(data)
+			}
+			emit(ev)
+			messages = append(messages, ChatMessage{Role: "tool", Content: result, ToolCallID: call.ID})
+		}
+		if err := ctx.Err(); err != nil {
+			return "", context.Cause(ctx)
+		}
+	}
+
+	// 达到轮数上限，不再提供工具，要求模型根据已有结果作答
+	reply, err := complete(ctx, messages, nil)
+	if err != nil {
+		return "", err
+	}
+	return reply.Content, nil
+}
@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// token用量
+type TokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// 用量记录器，提供者在调用完成后将上游返回的用量写入其中。
+// 记录器可以嵌套，用量同时累加到外层的记录器
+type UsageRecorder struct {
+	mu     sync.Mutex
+	usage  TokenUsage
+	parent *UsageRecorder
+}
+
+func (r *UsageRecorder) Add(u TokenUsage) {
+	r.mu.Lock()
+	r.usage.PromptTokens += u.PromptTokens
+	r.usage.CompletionTokens += u.CompletionTokens
+	r.usage.TotalTokens += u.TotalTokens
+	r.mu.Unlock()
+	if r.parent != nil {
+		r.parent.Add(u)
+	}
+}
+
+func (r *UsageRecorder) Usage() TokenUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.usage
+}
+
+type usageRecorderKey struct{}
+
+// 在context上挂载用量记录器，不需要用量的调用方无需关心
+func WithUsageRecorder(ctx context.Context) (context.Context, *UsageRecorder) {
+	parent, _ := ctx.Value(usageRecorderKey{}).(*UsageRecorder)
+	r := &UsageRecorder{parent: parent}
+	return context.WithValue(ctx, usageRecorderKey{}, r), r
+}
+
+// 记录一次上游调用的用量，context未挂载记录器时忽略
+func recordUsage(ctx context.Context, u TokenUsage) {
+	if r, ok := ctx.Value(usageRecorderKey{}).(*UsageRecorder); ok {
+		r.Add(u)
+	}
+}
+
+// 单个字符的token权重：CJK字符约一字一token，其余字符约四个一token
+func TokenWeight(r rune) float64 {
+	if r >= 0x2E80 {
+		return 1
+	}
+	return 0.25
+}
+
+// 粗略估算文本的token数，用于在调用前控制上下文长度
+func EstimateTokens(text string) int {
+	var n float64
+	for _, r := range text {
+		n += TokenWeight(r)
+	}
+	return int(math.Ceil(n))
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
 )
 
 // 文心一言配置
@@ -59,13 +61,12 @@ type WenxinResponse struct {
 type WenxinProvider struct {
 	config WenxinConfig
 	client *http.Client
+	// 调用方未设置截止时间时的默认超时
+	timeout time.Duration
 }
 
 // 创建文心一言提供者
-func NewWenxinProvider() *WenxinProvider {
-	// 使用配置管理系统
-	config := GetAIConfig().AI.Wenxin
-
+func NewWenxinProvider(config ModelConfig) *WenxinProvider {
 	return &WenxinProvider{
 		config: WenxinConfig{
 			APIKey:      config.APIKey,
@@ -74,9 +75,8 @@ func NewWenxinProvider() *WenxinProvider {
 			MaxTokens:   config.MaxTokens,
 			Temperature: config.Temperature,
 		},
-		client: &http.Client{
-			Timeout: 60 * time.Second, // 文心一言可能需要更长时间处理长文本
-		},
+		client:  logging.NewClient(0),
+		timeout: 60 * time.Second, // 文心一言可能需要更长时间处理长文本
 	}
 }
 
@@ -130,6 +130,9 @@ func (w *WenxinProvider) callAI(ctx context.Context, function, content string) (
 		return "", fmt.Errorf("文心一言API未配置")
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx, w.timeout)
+	defer cancel()
+
 	// 构建提示词
 	var systemPrompt string
 	switch function {
@@ -191,6 +194,11 @@ func (w *WenxinProvider) callAI(ctx context.Context, function, content string) (
 	if len(response.Choices) == 0 {
 		return "", fmt.Errorf("API返回结果为空")
 	}
+	recordUsage(ctx, TokenUsage{
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+	})
 
 	return response.Choices[0].Message.Content, nil
 }
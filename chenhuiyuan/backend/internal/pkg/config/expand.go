@@ -0,0 +1,26 @@
+package config
+
+import (
+	"os"
+	"regexp"
+)
+
+// ${VAR}或${VAR:-default}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// 展开字符串中的环境变量引用：${VAR}替换为变量值（未设置时为空），
+// ${VAR:-default}在变量未设置或为空时使用默认值
+func Expand(s string) string {
+	return expandWith(s, os.LookupEnv)
+}
+
+func expandWith(s string, lookup func(string) (string, bool)) string {
+	return envPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envPattern.FindStringSubmatch(ref)
+		value, _ := lookup(m[1])
+		if value == "" {
+			return m[2]
+		}
+		return value
+	})
+}
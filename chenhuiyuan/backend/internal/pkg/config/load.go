@@ -0,0 +1,253 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNotFound = errors.New("未找到配置文件")
+
+// 配置文件选项
+type Options struct {
+	Path    string // 配置文件路径，为空时依次查找当前目录和可执行文件所在目录下的configs/config.yaml
+	Profile string // 运行环境（如dev、prod），非空时在基础配置之上叠加同目录下的config.<profile>.yaml
+}
+
+var profilePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// 一个配置项的错误，Path为点分隔的YAML字段路径
+type FieldError struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		fmt.Fprintf(&b, "%s:%d: ", e.File, e.Line)
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// 配置错误列表，一次报告全部问题
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, fe := range e {
+		lines[i] = "  - " + fe.Error()
+	}
+	return "配置有误:\n" + strings.Join(lines, "\n")
+}
+
+// 按选项确定要加载的配置文件，基础配置在前、环境配置在后
+func Files(opts Options) ([]string, error) {
+	base := opts.Path
+	if base == "" {
+		candidates := []string{filepath.Join("configs", "config.yaml")}
+		if exe, err := os.Executable(); err == nil {
+			candidates = append(candidates, filepath.Join(filepath.Dir(exe), "configs", "config.yaml"))
+		}
+		for _, p := range candidates {
+			if _, err := os.Stat(p); err == nil {
+				base = p
+				break
+			}
+		}
+		if base == "" {
+			return nil, fmt.Errorf("%w，尝试过的路径: %v", ErrNotFound, candidates)
+		}
+	} else if _, err := os.Stat(base); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	files := []string{base}
+	if opts.Profile != "" {
+		if !profilePattern.MatchString(opts.Profile) {
+			return nil, fmt.Errorf("无效的运行环境名: %q", opts.Profile)
+		}
+		ext := filepath.Ext(base)
+		overlay := strings.TrimSuffix(base, ext) + "." + opts.Profile + ext
+		if _, err := os.Stat(overlay); err == nil {
+			files = append(files, overlay)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+	}
+	return files, nil
+}
+
+// 依次把配置文件解码到out（已填好默认值的结构体指针），后面的文件覆盖前面文件中的同名字段。
+// 字符串中的环境变量引用会被展开；未知字段和类型错误汇总为Errors，其中不包含密钥的原值
+func Load(files []string, out any) error {
+	var errs Errors
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("解析配置文件%s失败: %w", f, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		root := doc.Content[0]
+		fileErrs := checkNode(root, reflect.TypeOf(out).Elem(), "", false)
+		for i := range fileErrs {
+			fileErrs[i].File = f
+		}
+		if len(fileErrs) > 0 {
+			errs = append(errs, fileErrs...)
+			continue
+		}
+		if err := root.Decode(out); err != nil {
+			return fmt.Errorf("解析配置文件%s失败: %s", f, maskQuoted(err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// 对照目标类型检查YAML节点：报告未知字段和无法转换的值，同时展开字符串中的环境变量
+func checkNode(n *yaml.Node, t reflect.Type, path string, secret bool) Errors {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return nil
+	}
+	fail := func(msg string) Errors {
+		return Errors{{Line: n.Line, Path: path, Message: msg}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return fail("应为对象")
+		}
+		var errs Errors
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			field, ok := fieldByYAMLName(t, key.Value)
+			if !ok {
+				errs = append(errs, FieldError{Line: key.Line, Path: joinPath(path, key.Value), Message: "未知的配置项"})
+				continue
+			}
+			errs = append(errs, checkNode(value, field.Type, joinPath(path, key.Value), field.Tag.Get("secret") == "true")...)
+		}
+		return errs
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return fail("应为对象")
+		}
+		var errs Errors
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			errs = append(errs, checkNode(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value), secret)...)
+		}
+		return errs
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return fail("应为列表")
+		}
+		var errs Errors
+		for i, item := range n.Content {
+			errs = append(errs, checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), secret)...)
+		}
+		return errs
+	case reflect.Interface:
+		return nil
+	}
+
+	if n.Kind != yaml.ScalarNode {
+		return fail("应为单个值")
+	}
+	n.Value = Expand(n.Value)
+	shown := n.Value
+	if secret {
+		shown = Mask(shown)
+	}
+
+	var err error
+	expect := ""
+	switch k := t.Kind(); {
+	case t == durationType:
+		_, err = time.ParseDuration(n.Value)
+		expect = "应为时长，如30s、10m"
+	case k == reflect.Bool:
+		_, err = strconv.ParseBool(n.Value)
+		expect = "应为true或false"
+	case k >= reflect.Int && k <= reflect.Int64:
+		_, err = strconv.ParseInt(n.Value, 10, 64)
+		expect = "应为整数"
+	case k >= reflect.Uint && k <= reflect.Uint64:
+		_, err = strconv.ParseUint(n.Value, 10, 64)
+		expect = "应为非负整数"
+	case k == reflect.Float32 || k == reflect.Float64:
+		_, err = strconv.ParseFloat(n.Value, 64)
+		expect = "应为数字"
+	default:
+		// 字符串保持原样
+		return nil
+	}
+	if err != nil {
+		return fail(fmt.Sprintf("%s（当前值: %q）", expect, shown))
+	}
+	// 展开后的值按目标类型重新解析（如port: "${SERVER_PORT}"）
+	n.Tag = ""
+	n.Style = 0
+	return nil
+}
+
+// 按yaml标签（缺省为小写字段名）查找结构体字段
+func fieldByYAMLName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if yamlName(f) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func yamlName(f reflect.StructField) string {
+	tag := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if tag == "" {
+		return strings.ToLower(f.Name)
+	}
+	return tag
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
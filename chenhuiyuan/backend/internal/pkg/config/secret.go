@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 密钥脱敏显示：保留前3位和后4位，较短的值全部隐藏
+func Mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) < 12 {
+		return "****"
+	}
+	return s[:3] + "****" + s[len(s)-4:]
+}
+
+// yaml解码错误会在反引号中给出原值，无法确定字段时一律隐藏
+var quotedValue = regexp.MustCompile("`[^`]*`")
+
+func maskQuoted(msg string) string {
+	return quotedValue.ReplaceAllString(msg, "`****`")
+}
+
+// 以YAML格式输出配置，标记了secret:"true"的字段脱敏显示
+func Print(w io.Writer, v any) error {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return err
+	}
+	maskNode(&n, reflect.TypeOf(v), false)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(&n)
+}
+
+func maskNode(n *yaml.Node, t reflect.Type, secret bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			switch t.Kind() {
+			case reflect.Struct:
+				if f, ok := fieldByYAMLName(t, key.Value); ok {
+					maskNode(value, f.Type, f.Tag.Get("secret") == "true")
+				}
+			case reflect.Map:
+				maskNode(value, t.Elem(), secret)
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice {
+			for _, item := range n.Content {
+				maskNode(item, t.Elem(), secret)
+			}
+		}
+	case yaml.ScalarNode:
+		if secret {
+			n.Value = Mask(n.Value)
+		}
+	}
+}
+
+// 依次对标记了secret:"true"的字符串字段调用fn，fn可以改写字段值（如解析密钥引用），
+// 返回的错误按字段路径汇总为Errors
+func WalkSecrets(v any, fn func(path string, value *string) error) error {
+	var errs Errors
+	walkSecrets(reflect.ValueOf(v), "", false, fn, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func walkSecrets(v reflect.Value, path string, secret bool, fn func(string, *string) error, errs *Errors) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.IsExported() {
+				walkSecrets(v.Field(i), joinPath(path, yamlName(f)), f.Tag.Get("secret") == "true", fn, errs)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkSecrets(v.Index(i), fmt.Sprintf("%s[%d]", path, i), secret, fn, errs)
+		}
+	case reflect.String:
+		if !secret || !v.CanSet() {
+			return
+		}
+		s := v.String()
+		if err := fn(path, &s); err != nil {
+			*errs = append(*errs, FieldError{Path: path, Message: err.Error()})
+			return
+		}
+		v.SetString(s)
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 按validate标签校验配置，返回全部不满足的字段。支持的规则（逗号分隔）：
+//
+//	required   不能为空（零值）
+//	min=N      数值或时长不能小于N
+//	max=N      数值或时长不能大于N
+//	oneof=a b  字符串（或字符串列表的每一项）必须是列出的值之一，空值不检查
+//	url        非空时必须是http或https地址
+//
+// 标记了secret:"true"的字段在错误信息中只显示脱敏后的值
+func Validate(v any) error {
+	var errs Errors
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, errs *Errors) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fieldPath := joinPath(path, yamlName(f))
+			fv := v.Field(i)
+			if rules := f.Tag.Get("validate"); rules != "" {
+				for _, rule := range strings.Split(rules, ",") {
+					if msg := checkRule(fv, rule); msg != "" {
+						*errs = append(*errs, FieldError{Path: fieldPath, Message: msg + currentValue(fv, f.Tag.Get("secret") == "true")})
+					}
+				}
+			}
+			validateValue(fv, fieldPath, errs)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), joinPath(path, fmt.Sprint(iter.Key().Interface())), errs)
+		}
+	}
+}
+
+// 检查一条规则，返回空字符串表示通过
+func checkRule(v reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return "不能为空"
+		}
+	case "min", "max":
+		n, ok := number(v)
+		if !ok {
+			return ""
+		}
+		limit, err := parseLimit(v, arg)
+		if err != nil {
+			return "校验规则无效: " + rule
+		}
+		if name == "min" && n < limit {
+			return "不能小于" + arg
+		}
+		if name == "max" && n > limit {
+			return "不能大于" + arg
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		check := func(s string) bool {
+			if s == "" {
+				return true
+			}
+			for _, a := range allowed {
+				if s == a {
+					return true
+				}
+			}
+			return false
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			if !check(v.String()) {
+				return "必须是以下之一: " + strings.Join(allowed, "、")
+			}
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+			for i := 0; i < v.Len(); i++ {
+				if !check(v.Index(i).String()) {
+					return fmt.Sprintf("第%d项必须是以下之一: %s", i+1, strings.Join(allowed, "、"))
+				}
+			}
+		}
+	case "url":
+		if v.Kind() != reflect.String || v.String() == "" {
+			return ""
+		}
+		u, err := url.Parse(v.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "不是合法的http(s)地址"
+		}
+	default:
+		return "未知的校验规则: " + rule
+	}
+	return ""
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// 时长字段的上下限写作时长（如min=1s），其余为数字
+func parseLimit(v reflect.Value, arg string) (float64, error) {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(arg)
+		return float64(d), err
+	}
+	return strconv.ParseFloat(arg, 64)
+}
+
+func currentValue(v reflect.Value, secret bool) string {
+	if v.Kind() != reflect.String && v.Type() != durationType {
+		if _, ok := number(v); !ok {
+			return ""
+		}
+	}
+	shown := fmt.Sprint(v.Interface())
+	if secret {
+		shown = Mask(shown)
+	}
+	return fmt.Sprintf("（当前值: %q）", shown)
+}
@@ -0,0 +1,106 @@
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 语言代码对应的中文名称，用于拼接提示词
+var names = map[string]string{
+	"zh": "中文",
+	"en": "英语",
+	"ja": "日语",
+	"ko": "韩语",
+	"fr": "法语",
+	"de": "德语",
+	"es": "西班牙语",
+	"ru": "俄语",
+	"ar": "阿拉伯语",
+	"th": "泰语",
+}
+
+// 返回语言代码对应的名称，未知代码原样返回
+func Name(code string) string {
+	if n, ok := names[strings.ToLower(code)]; ok {
+		return n
+	}
+	return code
+}
+
+// 拉丁字母语言的常见功能词，用于区分同一文字体系下的语言
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "that", "it", "with", "for", "this"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "dans", "que", "pour", "pas", "sur"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "mit", "zu", "auf", "ich"},
+	"es": {"el", "los", "las", "y", "es", "que", "una", "por", "con", "para", "del", "como"},
+}
+
+// 根据文字体系和常见词粗略识别文本语言，无法判断时返回空字符串
+func Detect(text string) string {
+	var han, kana, hangul, cyrillic, arabic, thai, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	// 日文通常混用汉字和假名，假名占比不低时判为日语
+	if kana > 0 && kana*5 >= han {
+		return "ja"
+	}
+	scripts := []struct {
+		code  string
+		count int
+	}{
+		{"zh", han}, {"ko", hangul}, {"ru", cyrillic}, {"ar", arabic}, {"th", thai}, {"latin", latin},
+	}
+	best := scripts[0]
+	for _, s := range scripts[1:] {
+		if s.count > best.count {
+			best = s
+		}
+	}
+	if best.count == 0 {
+		return ""
+	}
+	if best.code != "latin" {
+		return best.code
+	}
+	return detectLatin(text)
+}
+
+// 按功能词命中次数区分拉丁字母语言，默认英语
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	seen := make(map[string]int, len(words))
+	for _, w := range words {
+		seen[w]++
+	}
+
+	best, bestScore := "en", 0
+	for _, lang := range []string{"en", "fr", "de", "es"} {
+		score := 0
+		for _, w := range stopwords[lang] {
+			score += seen[w]
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
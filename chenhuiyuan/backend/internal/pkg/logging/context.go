@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type attrsKey struct{}
+
+// 在context中附加日志字段，之后使用该context记录的日志都会带上这些字段
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(prev)+len(attrs))
+	merged = append(merged, prev...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+// 把src中的日志字段复制到ctx，用于脱离请求生命周期的后台任务
+func CopyAttrs(ctx, src context.Context) context.Context {
+	attrs, _ := src.Value(attrsKey{}).([]slog.Attr)
+	if len(attrs) == 0 {
+		return ctx
+	}
+	return WithAttrs(ctx, attrs...)
+}
+
+// 请求ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return WithAttrs(ctx, slog.String("request_id", id))
+}
+
+// 读取context中的请求ID，没有时返回空
+func RequestID(ctx context.Context) string {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	for _, a := range attrs {
+		if a.Key == "request_id" {
+			return a.Value.String()
+		}
+	}
+	return ""
+}
+
+// 把context中的字段加入每条日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
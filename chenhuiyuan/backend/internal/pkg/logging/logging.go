@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/secrets"
+)
+
+// 日志选项，由配置文件的logging部分转换而来
+type Options struct {
+	Level      string // debug、info、warn、error
+	Format     string // json或text
+	Output     string // stdout、stderr或日志文件路径
+	MaxSizeMB  int    // 日志文件达到该大小后轮转，0表示不轮转
+	MaxBackups int    // 保留的旧日志文件数，0表示不限制
+	MaxAge     time.Duration
+}
+
+// 当前日志级别，配置重新加载时可以修改
+var level = new(slog.LevelVar)
+
+// 按选项创建日志并设为slog的默认日志（标准库log的输出也转到这里，按info级别记录），
+// 返回的Closer用于关闭日志文件。
+// 日志中出现的密钥值一律替换为[secret:名称]
+func Setup(opts Options) (io.Closer, error) {
+	if err := SetLevel(opts.Level); err != nil {
+		return nil, err
+	}
+
+	var w io.Writer
+	var closer io.Closer = io.NopCloser(nil)
+	switch opts.Output {
+	case "", "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := OpenRotatingFile(opts.Output, int64(opts.MaxSizeMB)<<20, opts.MaxBackups, opts.MaxAge)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	}
+	w = secrets.NewWriter(w)
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch opts.Format {
+	case "", "json":
+		h = slog.NewJSONHandler(w, handlerOpts)
+	case "text":
+		h = slog.NewTextHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("不支持的日志格式: %s", opts.Format)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+	return closer, nil
+}
+
+// 修改日志级别，立即生效
+func SetLevel(s string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return fmt.Errorf("无效的日志级别: %s", s)
+	}
+	level.Set(l)
+	return nil
+}
+
+// 日志中的错误字段
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.String("error", err.Error())
+}
+
+// 记录错误后退出进程，用于启动阶段无法继续运行的错误
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
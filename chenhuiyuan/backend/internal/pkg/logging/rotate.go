@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 旧日志文件名中的时间格式
+const backupTimeFormat = "20060102-150405.000"
+
+// 按大小轮转的日志文件。当前文件超过maxSize后重命名为“名称-时间.扩展名”，
+// 并按数量和保留时间清理旧文件
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, maxAge: maxAge}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		// 轮转失败时继续写当前文件，不丢日志
+		if err := f.rotateLocked(); err != nil {
+			fmt.Fprintf(os.Stderr, "日志文件轮转失败: %v\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) rotateLocked() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + time.Now().Format(backupTimeFormat) + ext
+	renameErr := os.Rename(f.path, backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	f.pruneLocked()
+	return nil
+}
+
+// 删除超出数量或保留时间的旧日志文件
+func (f *RotatingFile) pruneLocked() {
+	ext := filepath.Ext(f.path)
+	prefix := filepath.Base(strings.TrimSuffix(f.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		name string
+		at   time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		at, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name, at})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].at.After(backups[j].at) })
+
+	now := time.Now()
+	for i, b := range backups {
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && now.Sub(b.at) > f.maxAge) {
+			os.Remove(filepath.Join(filepath.Dir(f.path), b.name))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/metrics"
+)
+
+var (
+	upstreamRequests = metrics.NewCounterVec("upstream_requests_total",
+		"调用上游接口的次数，status为HTTP状态码，连接失败时为error", "host", "status")
+	upstreamDuration = metrics.NewHistogramVec("upstream_request_duration_seconds",
+		"调用上游接口到收到响应头的时间", metrics.DefaultBuckets, "host")
+)
+
+// 调用上游接口（模型提供者等）的Transport：转发请求ID，记录指标，并以debug级别记录每次调用
+type Transport struct {
+	Base http.RoundTripper // 为nil时使用http.DefaultTransport
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if id := RequestID(ctx); id != "" && req.Header.Get("X-Request-ID") == "" {
+		req = req.Clone(ctx)
+		req.Header.Set("X-Request-ID", id)
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(start)
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("host", req.URL.Host),
+		slog.String("path", req.URL.Path),
+		slog.Int64("latency_ms", elapsed.Milliseconds()),
+	}
+	status := "error"
+	if err != nil {
+		attrs = append(attrs, Err(err))
+	} else {
+		status = strconv.Itoa(resp.StatusCode)
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			metrics.RateLimitRejections.Inc("upstream")
+		}
+	}
+	upstreamRequests.Inc(req.URL.Host, status)
+	upstreamDuration.Observe(elapsed.Seconds(), req.URL.Host)
+	slog.LogAttrs(ctx, slog.LevelDebug, "上游请求", attrs...)
+	return resp, err
+}
+
+// 带Transport的HTTP客户端
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: &Transport{}, Timeout: timeout}
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// 默认的耗时分桶（秒），覆盖从毫秒级接口到数分钟的长文本生成
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// 指标注册表，按Prometheus文本格式输出
+type Registry struct {
+	mu   sync.Mutex
+	vecs []*vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// 全局注册表，各包的指标在初始化时注册到这里
+var Default = NewRegistry()
+
+func (r *Registry) register(v *vec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.vecs {
+		if existing.name == v.name {
+			panic("metrics: 重复注册指标 " + v.name)
+		}
+	}
+	r.vecs = append(r.vecs, v)
+}
+
+// 以Prometheus文本格式（0.0.4）输出全部指标，按名称排序
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	vecs := append([]*vec(nil), r.vecs...)
+	r.mu.Unlock()
+	sort.Slice(vecs, func(i, j int) bool { return vecs[i].name < vecs[j].name })
+
+	var b strings.Builder
+	for _, v := range vecs {
+		v.write(&b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// /metrics接口
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// 一组同名指标，按标签值区分
+type vec struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64 // 仅直方图
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64  // 计数器和仪表盘的值，直方图的总和
+	count       uint64   // 直方图的观测次数
+	buckets     []uint64 // 直方图各分桶的计数（不累计）
+}
+
+func newVec(name, help, typ string, labels []string, buckets []float64) *vec {
+	v := &vec{name: name, help: help, typ: typ, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	Default.register(v)
+	return v
+}
+
+// 查找或创建标签值对应的序列，调用方需持有v.mu
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s需要%d个标签值，实际为%d个", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if v.typ == typeHistogram {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", v.name, v.typ)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.series[k]
+		if v.typ != typeHistogram {
+			fmt.Fprintf(b, "%s%s %s\n", v.name, v.labelString(s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range v.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, v.labelString(s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, v.labelString(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", v.name, v.labelString(s.labelValues, "", ""), formatFloat(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", v.name, v.labelString(s.labelValues, "", ""), s.count)
+	}
+}
+
+// {a="x",b="y"}形式的标签，extra不为空时追加（直方图的le）
+func (v *vec) labelString(values []string, extra, extraValue string) string {
+	if len(values) == 0 && extra == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range v.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if extra != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
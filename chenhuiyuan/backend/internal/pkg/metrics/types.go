@@ -0,0 +1,70 @@
+package metrics
+
+import "sort"
+
+// 只增不减的计数器
+type CounterVec struct{ v *vec }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, typeCounter, labels, nil)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// delta不能为负
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: 计数器不能减少")
+	}
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.get(labelValues).value += delta
+}
+
+// 可增可减的当前值
+type GaugeVec struct{ v *vec }
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, typeGauge, labels, nil)}
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.get(labelValues).value += delta
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+func (g *GaugeVec) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.get(labelValues).value = value
+}
+
+// 直方图，buckets为各分桶的上限（升序，不含+Inf）
+type HistogramVec struct{ v *vec }
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{newVec(name, help, typeHistogram, labels, buckets)}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	s := h.v.get(labelValues)
+	s.value += value
+	s.count++
+	if i := sort.SearchFloat64s(h.v.buckets, value); i < len(h.v.buckets) {
+		s.buckets[i]++
+	}
+}
+
+// 被限流拒绝的请求数，由各处的限流点共同计数
+var RateLimitRejections = NewCounterVec("rate_limit_rejections_total",
+	"因限流被拒绝的请求数，reason为login（登录失败限制）、job_queue（异步任务队列已满）或upstream（上游返回429）", "reason")
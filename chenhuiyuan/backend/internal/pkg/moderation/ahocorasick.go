@@ -0,0 +1,126 @@
+package moderation
+
+import "unicode"
+
+// 匹配结果，Start/End为文本中的字符（Unicode码点）偏移，左闭右开
+type Match struct {
+	Pattern int
+	Start   int
+	End     int
+}
+
+type acNode struct {
+	next   map[rune]int
+	fail   int
+	output []int // 以该节点结尾的模式（含经失败链可达的模式）
+	depth  int
+}
+
+// Aho-Corasick多模式匹配器，英文不区分大小写
+type Matcher struct {
+	nodes    []acNode
+	patterns [][]rune
+	maxLen   int
+}
+
+// 构建匹配器，空模式会被忽略
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{nodes: []acNode{{next: make(map[rune]int)}}}
+	for i, p := range patterns {
+		runes := normalize([]rune(p))
+		m.patterns = append(m.patterns, runes)
+		if len(runes) == 0 {
+			continue
+		}
+		m.maxLen = max(m.maxLen, len(runes))
+		cur := 0
+		for _, r := range runes {
+			nxt, ok := m.nodes[cur].next[r]
+			if !ok {
+				nxt = len(m.nodes)
+				m.nodes = append(m.nodes, acNode{next: make(map[rune]int), depth: m.nodes[cur].depth + 1})
+				m.nodes[cur].next[r] = nxt
+			}
+			cur = nxt
+		}
+		m.nodes[cur].output = append(m.nodes[cur].output, i)
+	}
+
+	// 按层次遍历构建失败指针
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			queue = append(queue, child)
+			f := m.nodes[cur].fail
+			for f != 0 {
+				if _, ok := m.nodes[f].next[r]; ok {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			if nxt, ok := m.nodes[f].next[r]; ok && nxt != child {
+				m.nodes[child].fail = nxt
+			}
+			m.nodes[child].output = append(m.nodes[child].output, m.nodes[m.nodes[child].fail].output...)
+		}
+	}
+	return m
+}
+
+// 最长模式的长度，流式匹配时需要保留这么多字符才能确认没有跨块的命中
+func (m *Matcher) MaxLen() int {
+	return m.maxLen
+}
+
+// 在整段文本中查找所有命中
+func (m *Matcher) FindAll(text string) []Match {
+	s := m.NewStream()
+	return s.Feed([]rune(text))
+}
+
+// 流式匹配状态，逐块输入文本，命中偏移为从第一块开始累计的绝对偏移
+type Stream struct {
+	m     *Matcher
+	state int
+	pos   int
+}
+
+func (m *Matcher) NewStream() *Stream {
+	return &Stream{m: m}
+}
+
+// 输入一段文本，返回本段内完成的命中（可能从之前的块开始）
+func (s *Stream) Feed(runes []rune) []Match {
+	var matches []Match
+	nodes := s.m.nodes
+	for _, r := range runes {
+		r = unicode.ToLower(r)
+		for s.state != 0 {
+			if _, ok := nodes[s.state].next[r]; ok {
+				break
+			}
+			s.state = nodes[s.state].fail
+		}
+		if nxt, ok := nodes[s.state].next[r]; ok {
+			s.state = nxt
+		}
+		s.pos++
+		for _, p := range nodes[s.state].output {
+			matches = append(matches, Match{Pattern: p, Start: s.pos - len(s.m.patterns[p]), End: s.pos})
+		}
+	}
+	return matches
+}
+
+func normalize(runes []rune) []rune {
+	out := make([]rune, len(runes))
+	for i, r := range runes {
+		out[i] = unicode.ToLower(r)
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// 审计记录
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Subject   string    `json:"subject"` // 发起请求的用户
+	Provider  string    `json:"provider"`
+	Direction string    `json:"direction"`
+	Word      string    `json:"word"`
+	List      string    `json:"list"`
+	Action    Action    `json:"action"`
+	Context   string    `json:"context"` // 命中位置附近的文本（已打码）
+}
+
+// 内存中的审计日志，超出容量时丢弃最早的记录；每条记录同时写入服务日志
+type AuditLog struct {
+	mu       sync.Mutex
+	entries  []AuditEntry
+	capacity int
+}
+
+func NewAuditLog(capacity int) *AuditLog {
+	return &AuditLog{capacity: capacity}
+}
+
+// 服务日志中的用户和请求ID来自ctx
+func (a *AuditLog) add(ctx context.Context, e AuditEntry) {
+	slog.WarnContext(ctx, "敏感内容命中",
+		"model", e.Provider,
+		"direction", e.Direction,
+		"list", e.List,
+		"action", e.Action,
+		"word", e.Word,
+		"context", e.Context,
+	)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+	if len(a.entries) > a.capacity {
+		a.entries = a.entries[len(a.entries)-a.capacity:]
+	}
+}
+
+// 按时间倒序返回记录，subject为空时返回全部
+func (a *AuditLog) Entries(subject string, limit int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]AuditEntry, 0)
+	for i := len(a.entries) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if subject == "" || a.entries[i].Subject == subject {
+			out = append(out, a.entries[i])
+		}
+	}
+	return out
+}
+
+type subjectKey struct{}
+
+// 在context上标记发起请求的用户，用于审计
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+func subjectFrom(ctx context.Context) string {
+	s, _ := ctx.Value(subjectKey{}).(string)
+	return s
+}
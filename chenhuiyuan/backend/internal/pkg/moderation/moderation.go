@@ -0,0 +1,178 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/ai"
+)
+
+// 命中后的处理方式
+type Action string
+
+const (
+	ActionBlock Action = "block" // 拦截整个请求或输出
+	ActionMask  Action = "mask"  // 用*替换命中的词
+	ActionFlag  Action = "flag"  // 仅记录审计日志
+)
+
+// 审核方向
+const (
+	DirectionInput  = "input"
+	DirectionOutput = "output"
+)
+
+var ErrBlocked = errors.New("内容包含敏感信息，已被拦截")
+
+// 一次命中
+type Hit struct {
+	Word   string `json:"word"`
+	List   string `json:"list"`
+	Action Action `json:"action"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+type rule struct {
+	word   string
+	list   string
+	action Action
+}
+
+// 敏感内容审核器
+type Moderator struct {
+	cfg     ai.ModerationConfig
+	rules   []rule
+	matcher *Matcher
+	audit   *AuditLog
+}
+
+// 根据配置加载敏感词表，未启用时返回nil
+func New(cfg ai.ModerationConfig, audit *AuditLog) (*Moderator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	m := &Moderator{cfg: cfg, audit: audit}
+	for _, list := range cfg.Lists {
+		action := Action(list.Action)
+		switch action {
+		case ActionBlock, ActionMask, ActionFlag:
+		case "":
+			action = ActionFlag
+		default:
+			return nil, fmt.Errorf("敏感词表%s的处理方式无效: %s", list.Name, list.Action)
+		}
+		words := append([]string(nil), list.Words...)
+		if list.File != "" {
+			fileWords, err := readWordFile(list.File)
+			if err != nil {
+				return nil, fmt.Errorf("读取敏感词表%s失败: %w", list.Name, err)
+			}
+			words = append(words, fileWords...)
+		}
+		for _, w := range words {
+			if w = strings.TrimSpace(w); w != "" {
+				m.rules = append(m.rules, rule{word: w, list: list.Name, action: action})
+			}
+		}
+	}
+
+	patterns := make([]string, len(m.rules))
+	for i, r := range m.rules {
+		patterns[i] = r.word
+	}
+	m.matcher = NewMatcher(patterns)
+	return m, nil
+}
+
+// 审核结果
+type Result struct {
+	Text    string `json:"text"` // 打码后的文本
+	Blocked bool   `json:"blocked"`
+	Hits    []Hit  `json:"hits"`
+}
+
+// 审核整段文本，命中会写入审计日志
+func (m *Moderator) Check(ctx context.Context, provider, direction, text string) Result {
+	runes := []rune(text)
+	hits := m.hits(m.matcher.FindAll(text))
+	res := Result{Hits: hits}
+	for _, h := range hits {
+		switch h.Action {
+		case ActionBlock:
+			res.Blocked = true
+		case ActionMask:
+			maskRunes(runes, h.Start, h.End)
+		}
+	}
+	res.Text = string(runes)
+	m.record(ctx, provider, direction, runes, hits)
+	return res
+}
+
+// 把匹配结果转换为命中，按出现位置排序
+func (m *Moderator) hits(matches []Match) []Hit {
+	hits := make([]Hit, 0, len(matches))
+	for _, mt := range matches {
+		r := m.rules[mt.Pattern]
+		hits = append(hits, Hit{Word: r.word, List: r.list, Action: r.action, Start: mt.Start, End: mt.End})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Start < hits[j].Start })
+	return hits
+}
+
+func (m *Moderator) record(ctx context.Context, provider, direction string, runes []rune, hits []Hit) {
+	if m.audit == nil {
+		return
+	}
+	for _, h := range hits {
+		m.audit.add(ctx, AuditEntry{
+			Time:      time.Now(),
+			Subject:   subjectFrom(ctx),
+			Provider:  provider,
+			Direction: direction,
+			Word:      h.Word,
+			List:      h.List,
+			Action:    h.Action,
+			Context:   excerpt(runes, h.Start, h.End),
+		})
+	}
+}
+
+func maskRunes(runes []rune, start, end int) {
+	for i := max(start, 0); i < end && i < len(runes); i++ {
+		runes[i] = '*'
+	}
+}
+
+// 命中位置前后各取10个字作为审计上下文，命中部分已打码
+func excerpt(runes []rune, start, end int) string {
+	from, to := max(start-10, 0), min(end+10, len(runes))
+	ctx := append([]rune(nil), runes[from:to]...)
+	maskRunes(ctx, start-from, end-from)
+	return string(ctx)
+}
+
+func readWordFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, scanner.Err()
+}
@@ -0,0 +1,183 @@
+package moderation
+
+import (
+	"context"
+	"io"
+
+	"ai-writing-assistant/internal/pkg/ai"
+)
+
+// 为提供者加上审核：调用前审核输入，调用后审核输出，流式输出逐块审核。
+// m为nil时原样返回
+func Wrap(p ai.Provider, m *Moderator) ai.Provider {
+	if m == nil {
+		return p
+	}
+	w := &moderatedProvider{Provider: p, m: m, name: p.GetModelInfo().Provider}
+	if _, ok := p.(ai.ToolChatter); ok {
+		return &moderatedToolProvider{w}
+	}
+	return w
+}
+
+type moderatedProvider struct {
+	ai.Provider
+	m    *Moderator
+	name string
+}
+
+// 供健康探测找到被包装的提供者
+func (p *moderatedProvider) Unwrap() ai.Provider {
+	return p.Provider
+}
+
+func (p *moderatedProvider) checkInput(ctx context.Context, text string) (string, error) {
+	if !p.m.cfg.CheckInput {
+		return text, nil
+	}
+	res := p.m.Check(ctx, p.name, DirectionInput, text)
+	if res.Blocked {
+		return "", ErrBlocked
+	}
+	return res.Text, nil
+}
+
+func (p *moderatedProvider) checkOutput(ctx context.Context, text string, err error) (string, error) {
+	if err != nil || !p.m.cfg.CheckOutput {
+		return text, err
+	}
+	res := p.m.Check(ctx, p.name, DirectionOutput, text)
+	if res.Blocked {
+		return "", ErrBlocked
+	}
+	return res.Text, nil
+}
+
+func (p *moderatedProvider) ContinueWriting(ctx context.Context, prompt string) (string, error) {
+	prompt, err := p.checkInput(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	out, err := p.Provider.ContinueWriting(ctx, prompt)
+	return p.checkOutput(ctx, out, err)
+}
+
+func (p *moderatedProvider) PolishText(ctx context.Context, text string) (string, error) {
+	text, err := p.checkInput(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	out, err := p.Provider.PolishText(ctx, text)
+	return p.checkOutput(ctx, out, err)
+}
+
+func (p *moderatedProvider) SummarizeText(ctx context.Context, text string) (string, error) {
+	text, err := p.checkInput(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	out, err := p.Provider.SummarizeText(ctx, text)
+	return p.checkOutput(ctx, out, err)
+}
+
+func (p *moderatedProvider) Chat(ctx context.Context, message, sessionID string) (string, error) {
+	message, err := p.checkInput(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	out, err := p.Provider.Chat(ctx, message, sessionID)
+	return p.checkOutput(ctx, out, err)
+}
+
+func (p *moderatedProvider) CompleteJSON(ctx context.Context, systemPrompt, prompt string) (string, error) {
+	prompt, err := p.checkInput(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	out, err := ai.CompleteJSON(ctx, p.Provider, systemPrompt, prompt)
+	return p.checkOutput(ctx, out, err)
+}
+
+func (p *moderatedProvider) CallAIStream(ctx context.Context, function, content, sessionID string, writer io.Writer) error {
+	content, err := p.checkInput(ctx, content)
+	if err != nil {
+		return err
+	}
+	if !p.m.cfg.CheckOutput {
+		return p.Provider.CallAIStream(ctx, function, content, sessionID, writer)
+	}
+
+	// 命中拦截词时取消上游生成
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	f := &streamFilter{ctx: ctx, p: p, out: writer, stream: p.m.matcher.NewStream(), cancel: cancel}
+	err = p.Provider.CallAIStream(ctx, function, content, sessionID, f)
+	if f.blocked {
+		return ErrBlocked
+	}
+	f.flush(len(f.seen))
+	return err
+}
+
+// 支持工具调用的提供者，审核用户消息和最终回答
+type moderatedToolProvider struct {
+	*moderatedProvider
+}
+
+func (p *moderatedToolProvider) ChatWithTools(ctx context.Context, message, sessionID string, tools *ai.ToolRegistry, opts ai.ToolOptions) (string, error) {
+	message, err := p.checkInput(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	out, err := p.Provider.(ai.ToolChatter).ChatWithTools(ctx, message, sessionID, tools, opts)
+	return p.checkOutput(ctx, out, err)
+}
+
+// 流式输出审核：保留末尾不足一个最长敏感词的字符暂不输出，
+// 确认不会与后续内容组成敏感词后再写出
+type streamFilter struct {
+	ctx     context.Context
+	p       *moderatedProvider
+	out     io.Writer
+	stream  *Stream
+	cancel  context.CancelCauseFunc
+	seen    []rune // 已收到的全部输出（打码后）
+	emitted int    // 已写出的字符数
+	blocked bool
+}
+
+func (f *streamFilter) Write(b []byte) (int, error) {
+	if f.blocked {
+		return len(b), nil
+	}
+	runes := []rune(string(b))
+	matches := f.stream.Feed(runes)
+	f.seen = append(f.seen, runes...)
+
+	hits := f.p.m.hits(matches)
+	for _, h := range hits {
+		switch h.Action {
+		case ActionBlock:
+			f.blocked = true
+		case ActionMask:
+			maskRunes(f.seen, h.Start, h.End)
+		}
+	}
+	f.p.m.record(f.ctx, f.p.name, DirectionOutput, f.seen, hits)
+	if f.blocked {
+		f.cancel(ErrBlocked)
+		return len(b), nil
+	}
+
+	f.flush(len(f.seen) - max(f.p.m.matcher.MaxLen()-1, 0))
+	return len(b), nil
+}
+
+// 写出到end为止尚未写出的内容
+func (f *streamFilter) flush(end int) {
+	if end <= f.emitted {
+		return
+	}
+	f.out.Write([]byte(string(f.seen[f.emitted:end])))
+	f.emitted = end
+}
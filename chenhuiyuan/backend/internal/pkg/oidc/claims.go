@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// ID令牌中用到的声明
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	raw           jwt.MapClaims
+}
+
+// 按名称读取字符串声明，用于可配置的用户名声明
+func (c *Claims) String(name string) string {
+	s, _ := c.raw[name].(string)
+	return s
+}
+
+// 邮箱的域名部分（小写），没有邮箱时为空
+func (c *Claims) EmailDomain() string {
+	_, domain, ok := strings.Cut(c.Email, "@")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(domain)
+}
+
+// 校验ID令牌的签名、issuer、audience、有效期和nonce
+func (p *Provider) verify(ctx context.Context, meta *metadata, idToken, nonce string) (*Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID令牌无效: %w", err)
+	}
+
+	// 多个audience时authorized party必须是本服务
+	aud, _ := claims.GetAudience()
+	if azp, ok := claims["azp"].(string); (len(aud) > 1 || ok) && azp != p.cfg.ClientID {
+		return nil, errors.New("ID令牌无效: azp不匹配")
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("ID令牌无效: nonce不匹配")
+	}
+
+	c := &Claims{raw: claims}
+	c.Issuer, _ = claims.GetIssuer()
+	c.Subject, _ = claims.GetSubject()
+	if c.Subject == "" {
+		return nil, errors.New("ID令牌无效: 缺少sub")
+	}
+	c.Email = c.String("email")
+	c.Name = c.String("name")
+	// 有的身份提供者以字符串返回email_verified
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = v == "true"
+	}
+	return c, nil
+}
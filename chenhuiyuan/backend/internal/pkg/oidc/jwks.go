@@ -0,0 +1,134 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 密钥集合重新获取的最小间隔，防止伪造kid的令牌频繁触发请求
+const jwksRefreshInterval = time.Minute
+
+// 身份提供者的签名公钥，遇到未知kid时重新获取（身份提供者轮换密钥）
+type keySet struct {
+	client *http.Client
+	uri    string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newKeySet(client *http.Client, uri string) *keySet {
+	return &keySet{client: client, uri: uri}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// 按kid查找公钥
+func (s *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(s.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+	if err := s.fetchLocked(ctx); err != nil {
+		return nil, err
+	}
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+func (s *keySet) fetchLocked(ctx context.Context) error {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	s.fetched = time.Now()
+	if err := getJSON(ctx, s.client, s.uri, &doc); err != nil {
+		return fmt.Errorf("读取OIDC签名密钥失败: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// 不支持的密钥类型跳过，不影响其他密钥
+		if k, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = k
+		}
+	}
+	s.keys = keys
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("无效的RSA指数")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("不支持的椭圆曲线: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("无效的EC公钥")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("无效的密钥参数")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,178 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
+)
+
+// 身份提供者的发现文档中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// 客户端配置，由应用配置转换而来
+type Config struct {
+	Issuer       string // 身份提供者地址，从{Issuer}/.well-known/openid-configuration读取端点
+	ClientID     string
+	ClientSecret string // 公开客户端为空，仅依赖PKCE
+	RedirectURL  string
+	Scopes       []string // 始终包含openid
+}
+
+// OIDC客户端。端点在第一次使用时通过发现文档获取，之后缓存
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys *keySet
+}
+
+func New(cfg Config) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		client: logging.NewClient(10 * time.Second),
+	}
+}
+
+// 检查必填配置
+func Check(cfg Config) error {
+	switch {
+	case cfg.Issuer == "":
+		return errors.New("auth.oidc.issuer不能为空")
+	case cfg.ClientID == "":
+		return errors.New("auth.oidc.client_id不能为空")
+	case cfg.RedirectURL == "":
+		return errors.New("auth.oidc.redirect_url不能为空")
+	}
+	return nil
+}
+
+// 读取发现文档，issuer必须与配置一致
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, p.client, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("读取OIDC发现文档失败: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("OIDC发现文档的issuer不匹配: %s", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("OIDC发现文档缺少authorization_endpoint、token_endpoint或jwks_uri")
+	}
+	p.meta = &meta
+	p.keys = newKeySet(p.client, meta.JWKSURI)
+	return p.meta, nil
+}
+
+// 授权地址，浏览器跳转到这里登录
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.cfg.Scopes
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// 用授权码换取令牌并校验ID令牌，返回其中的声明
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求OIDC令牌端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("解析OIDC令牌响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("OIDC令牌端点返回错误: %d %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("OIDC令牌响应中没有id_token")
+	}
+	return p.verify(ctx, meta, body.IDToken, nonce)
+}
+
+func getJSON(ctx context.Context, client *http.Client, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
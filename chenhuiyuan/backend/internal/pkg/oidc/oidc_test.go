@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/oidc/oidctest"
+)
+
+func newTestProvider(idp *oidctest.Server) *Provider {
+	return New(Config{
+		Issuer:      idp.URL,
+		ClientID:    "writer",
+		RedirectURL: "https://writer.example.com/api/auth/oidc/callback",
+		Scopes:      []string{"profile", "email"},
+	})
+}
+
+// S256为SHA-256摘要的base64url编码（无填充），"abc"的摘要是ba7816bf...f20015ad
+func TestChallenge(t *testing.T) {
+	got := Challenge("abc")
+	if want := "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0"; got != want {
+		t.Fatalf("Challenge() = %q, want %q", got, want)
+	}
+	if v := RandomString(); len(v) < 43 || len(v) > 128 {
+		t.Fatalf("code_verifier长度%d不在43到128之间", len(v))
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	p := newTestProvider(idp)
+
+	raw, err := p.AuthCodeURL(context.Background(), "st", "nc", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.URL+"/authorize" {
+		t.Errorf("授权端点 = %q", got)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "writer",
+		"redirect_uri":          "https://writer.example.com/api/auth/oidc/callback",
+		"scope":                 "openid profile email",
+		"state":                 "st",
+		"nonce":                 "nc",
+		"code_challenge":        Challenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if q.Has("code_verifier") {
+		t.Error("授权地址中不能出现code_verifier")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		kid      string
+		verifier string // 为空时使用授权时的code_verifier
+		nonce    string // 为空时使用授权时的nonce
+		wantErr  string
+	}{
+		{name: "ok", claims: map[string]any{"email": "a@example.com", "email_verified": "true"}},
+		{name: "PKCE不匹配", verifier: RandomString(), wantErr: "invalid_grant"},
+		{name: "nonce不匹配", nonce: "other", wantErr: "nonce不匹配"},
+		{name: "缺少nonce", claims: map[string]any{"nonce": nil}, wantErr: "nonce不匹配"},
+		{name: "issuer不匹配", claims: map[string]any{"iss": "https://evil.example.com"}, wantErr: "issuer"},
+		{name: "audience不匹配", claims: map[string]any{"aud": "other-client"}, wantErr: "audience"},
+		{name: "多个audience缺少azp", claims: map[string]any{"aud": []string{"writer", "other-client"}}, wantErr: "azp不匹配"},
+		{name: "azp不是本服务", claims: map[string]any{"azp": "other-client"}, wantErr: "azp不匹配"},
+		{name: "已过期", claims: map[string]any{"exp": time.Now().Add(-2 * time.Minute).Unix()}, wantErr: "expired"},
+		{name: "缺少exp", claims: map[string]any{"exp": nil}, wantErr: "exp"},
+		{name: "未知kid", kid: "rotated-away", wantErr: "未知的签名密钥"},
+		{name: "缺少sub", claims: map[string]any{"sub": nil}, wantErr: "缺少sub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := oidctest.NewServer(t)
+			if tt.kid != "" {
+				idp.SigningKeyID = tt.kid
+			}
+			p := newTestProvider(idp)
+			ctx := context.Background()
+
+			nonce, verifier := RandomString(), RandomString()
+			authURL, err := p.AuthCodeURL(ctx, RandomString(), nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := idp.Authorize(authURL, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			claims, err := p.Exchange(ctx, code, verifier, nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Issuer != idp.URL || claims.Subject != "subject-1" {
+				t.Errorf("iss/sub = %q/%q", claims.Issuer, claims.Subject)
+			}
+			if claims.Email != "a@example.com" || !claims.EmailVerified || claims.EmailDomain() != "example.com" {
+				t.Errorf("email = %q verified=%v", claims.Email, claims.EmailVerified)
+			}
+		})
+	}
+}
+
+// 授权码只能换取一次令牌
+func TestExchangeCodeReuse(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	p := newTestProvider(idp)
+	ctx := context.Background()
+
+	nonce, verifier := RandomString(), RandomString()
+	authURL, err := p.AuthCodeURL(ctx, RandomString(), nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := idp.Authorize(authURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, verifier, nonce); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, verifier, nonce); err == nil {
+		t.Fatal("重复使用的授权码不应换取成功")
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	idp.Issuer = "https://other.example.com"
+	p := newTestProvider(idp)
+
+	_, err := p.AuthCodeURL(context.Background(), "st", "nc", "verifier")
+	if err == nil || !strings.Contains(err.Error(), "issuer不匹配") {
+		t.Fatalf("AuthCodeURL() error = %v, want issuer不匹配", err)
+	}
+}
+
+// 未知kid在最小间隔内不重复请求签名公钥
+func TestUnknownKeyIDRefetchLimited(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	idp.SigningKeyID = "forged"
+	p := newTestProvider(idp)
+	ctx := context.Background()
+
+	for range 3 {
+		nonce, verifier := RandomString(), RandomString()
+		authURL, err := p.AuthCodeURL(ctx, RandomString(), nonce, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := idp.Authorize(authURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Exchange(ctx, code, verifier, nonce); err == nil {
+			t.Fatal("未知kid的令牌不应通过校验")
+		}
+	}
+	if n := idp.JWKSRequests(); n != 1 {
+		t.Fatalf("签名公钥请求了%d次，want 1", n)
+	}
+}
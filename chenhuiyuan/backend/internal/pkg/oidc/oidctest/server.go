@@ -0,0 +1,180 @@
+// Package oidctest 提供测试用的OIDC身份提供者，包含发现文档、签名公钥和令牌端点
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// 发布在签名公钥中的kid
+const KeyID = "test-key"
+
+// 测试用身份提供者。Authorize模拟用户在身份提供者处完成登录，
+// 令牌端点按PKCE校验code_verifier后返回签名的ID令牌
+type Server struct {
+	*httptest.Server
+
+	// 发现文档中返回的issuer，默认为服务地址
+	Issuer string
+	// 签发ID令牌时使用的kid，默认KeyID
+	SigningKeyID string
+
+	key          *rsa.PrivateKey
+	jwksRequests atomic.Int32
+
+	mu    sync.Mutex
+	codes map[string]*grant
+}
+
+// 一次授权：PKCE code_challenge和将要签发的ID令牌声明
+type grant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+// 启动身份提供者，测试结束时自动关闭
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{SigningKeyID: KeyID, key: key, codes: make(map[string]*grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+	s.Issuer = s.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// 签名公钥被请求的次数
+func (s *Server) JWKSRequests() int {
+	return int(s.jwksRequests.Load())
+}
+
+// 模拟用户在授权地址完成登录，返回授权码。ID令牌包含有效的iss、aud、sub、nonce、iat和exp，
+// claims中的同名声明覆盖默认值，值为nil时删除该声明
+func (s *Server) Authorize(authURL string, claims map[string]any) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if q.Get("response_type") != "code" {
+		return "", errors.New("response_type不是code")
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		return "", errors.New("缺少PKCE S256 code_challenge")
+	}
+
+	now := time.Now()
+	g := &grant{
+		challenge:   q.Get("code_challenge"),
+		redirectURI: q.Get("redirect_uri"),
+		claims: jwt.MapClaims{
+			"iss":   s.Issuer,
+			"aud":   q.Get("client_id"),
+			"sub":   "subject-1",
+			"nonce": q.Get("nonce"),
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+		},
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(g.claims, k)
+		} else {
+			g.claims[k] = v
+		}
+	}
+
+	code := rand.Text()
+	s.mu.Lock()
+	s.codes[code] = g
+	s.mu.Unlock()
+	return code, nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.Issuer,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.jwksRequests.Add(1)
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// 授权码只能使用一次，code_verifier必须与授权时的code_challenge对应
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+	if !ok || r.PostForm.Get("redirect_uri") != g.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, g.claims)
+	token.Header["kid"] = s.SigningKeyID
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,182 @@
+package redact
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 个人信息类型
+type Type string
+
+const (
+	Phone  Type = "phone"  // 中国大陆手机号
+	IDCard Type = "idcard" // 居民身份证号
+	Email  Type = "email"
+	Name   Type = "name" // 人名
+)
+
+// 占位符前缀
+var placeholderPrefix = map[Type]string{
+	Phone:  "PHONE",
+	IDCard: "ID",
+	Email:  "EMAIL",
+	Name:   "NAME",
+}
+
+// 检测到的个人信息，Start/End为字节偏移
+type Span struct {
+	Type  Type   `json:"type"`
+	Start int    `json:"-"`
+	End   int    `json:"-"`
+	Value string `json:"value"`
+}
+
+var (
+	phonePattern  = regexp.MustCompile(`(?:\+?86[-\s]?)?1[3-9]\d[-\s]?\d{4}[-\s]?\d{4}`)
+	id18Pattern   = regexp.MustCompile(`[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]`)
+	id15Pattern   = regexp.MustCompile(`[1-9]\d{7}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	labeledName   = regexp.MustCompile(`(?:姓名|联系人|收件人|收货人|申请人|负责人|经办人)\s*[:：]\s*(\p{Han}{2,4})`)
+	honorificName = regexp.MustCompile(`(\p{Han}{2,3}?)(?:先生|女士|小姐|老师|经理|主任|同学|律师|医生)`)
+)
+
+// 常见姓氏，用于判断敬称前的汉字是否为人名
+var surnames = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, r := range "王李张刘陈杨黄赵吴周徐孙马朱胡郭何高林罗郑梁谢宋唐许韩冯邓曹彭曾肖田董袁潘于蒋蔡余杜叶程苏魏吕丁任沈姚卢姜崔钟谭陆汪范金石廖贾夏韦付方白邹孟熊秦邱江尹薛闫段雷侯龙史陶黎贺顾毛郝龚邵万钱严覃武戴莫孔向汤" {
+		m[string(r)] = true
+	}
+	for _, s := range []string{"欧阳", "司马", "诸葛", "上官", "东方", "慕容", "令狐", "皇甫"} {
+		m[s] = true
+	}
+	return m
+}()
+
+// 身份证校验码
+var idWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const idCheckCodes = "10X98765432"
+
+// 检测文本中的个人信息，names为额外需要脱敏的人名或词语
+func Detect(text string, types []Type, names []string) []Span {
+	enabled := make(map[Type]bool, len(types))
+	for _, t := range types {
+		enabled[t] = true
+	}
+
+	var spans []Span
+	add := func(t Type, start, end int) {
+		spans = append(spans, Span{Type: t, Start: start, End: end, Value: text[start:end]})
+	}
+	if enabled[IDCard] {
+		for _, loc := range id18Pattern.FindAllStringIndex(text, -1) {
+			if digitBoundary(text, loc[0], loc[1]) && validID18(text[loc[0]:loc[1]]) {
+				add(IDCard, loc[0], loc[1])
+			}
+		}
+		for _, loc := range id15Pattern.FindAllStringIndex(text, -1) {
+			if digitBoundary(text, loc[0], loc[1]) {
+				add(IDCard, loc[0], loc[1])
+			}
+		}
+	}
+	if enabled[Phone] {
+		for _, loc := range phonePattern.FindAllStringIndex(text, -1) {
+			if digitBoundary(text, loc[0], loc[1]) {
+				add(Phone, loc[0], loc[1])
+			}
+		}
+	}
+	if enabled[Email] {
+		for _, loc := range emailPattern.FindAllStringIndex(text, -1) {
+			add(Email, loc[0], loc[1])
+		}
+	}
+	if enabled[Name] {
+		for _, loc := range labeledName.FindAllStringSubmatchIndex(text, -1) {
+			add(Name, loc[2], loc[3])
+		}
+		for _, loc := range honorificName.FindAllStringSubmatchIndex(text, -1) {
+			if start, ok := nameStart(text, loc[2], loc[3]); ok {
+				add(Name, start, loc[3])
+			}
+		}
+	}
+	// 用户指定的词语不受类型开关影响
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		for i := 0; ; {
+			j := strings.Index(text[i:], n)
+			if j < 0 {
+				break
+			}
+			add(Name, i+j, i+j+len(n))
+			i += j + len(n)
+		}
+	}
+	return resolveOverlaps(spans)
+}
+
+// 数字串前后不能紧邻其他数字，避免从更长的数字中截取
+func digitBoundary(text string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); unicode.IsDigit(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		if r, _ := utf8.DecodeRuneInString(text[end:]); unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func validID18(id string) bool {
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(id[i]-'0') * idWeights[i]
+	}
+	return strings.EqualFold(string(idCheckCodes[sum%11]), id[17:])
+}
+
+// 敬称前的汉字从姓氏开始才视为人名（如“请联系王伟先生”中取“王伟”），返回人名起点
+func nameStart(text string, start, end int) (int, bool) {
+	candidate := text[start:end]
+	for i := range candidate {
+		rest := candidate[i:]
+		n := utf8.RuneCountInString(rest)
+		if n < 2 || n > 3 {
+			continue
+		}
+		runes := []rune(rest)
+		if surnames[string(runes[0])] || (n == 3 && surnames[string(runes[:2])]) {
+			return start + i, true
+		}
+	}
+	return 0, false
+}
+
+// 重叠时保留起点靠前、其次长度更长的一项
+func resolveOverlaps(spans []Span) []Span {
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	out := spans[:0]
+	end := -1
+	for _, s := range spans {
+		if s.Start >= end {
+			out = append(out, s)
+			end = s.End
+		}
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+package redact
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"ai-writing-assistant/internal/pkg/ai"
+)
+
+// 为第三方提供者加上脱敏：调用前把个人信息替换为占位符，返回后还原。
+// context中带有用户策略时优先使用，否则使用defaults
+func Wrap(p ai.Provider, defaults Policy) ai.Provider {
+	w := &redactedProvider{Provider: p, defaults: defaults}
+	if _, ok := p.(ai.ToolChatter); ok {
+		return &redactedToolProvider{w}
+	}
+	return w
+}
+
+type redactedProvider struct {
+	ai.Provider
+
+	mu       sync.Mutex
+	defaults Policy
+}
+
+// 更新Wrap返回的提供者的默认策略，各会话已有的对应关系不受影响。
+// p不是Wrap返回的提供者时返回false
+func SetDefaults(p ai.Provider, defaults Policy) bool {
+	w, ok := p.(interface{ setDefaults(Policy) })
+	if ok {
+		w.setDefaults(defaults)
+	}
+	return ok
+}
+
+func (p *redactedProvider) setDefaults(defaults Policy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaults = defaults
+}
+
+// 供健康探测找到被包装的提供者
+func (p *redactedProvider) Unwrap() ai.Provider {
+	return p.Provider
+}
+
+func (p *redactedProvider) policy(ctx context.Context) Policy {
+	if policy, ok := policyFrom(ctx); ok {
+		return policy
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.defaults
+}
+
+// 按功能脱敏文本，返回脱敏后的文本和用于还原的对应关系
+func (p *redactedProvider) redact(ctx context.Context, function, sessionID, text string) (string, *Vault) {
+	types, names := p.policy(ctx).For(functionFrom(ctx, function))
+	// 多轮对话的历史中保留着占位符，同一用户的同一会话需沿用同一份对应关系
+	v := sessionVaultFor(ownerFrom(ctx), sessionID)
+	return v.Redact(text, types, names), v
+}
+
+func restore(v *Vault, out string, err error) (string, error) {
+	if err != nil {
+		return out, err
+	}
+	return v.Restore(out), nil
+}
+
+func (p *redactedProvider) ContinueWriting(ctx context.Context, prompt string) (string, error) {
+	prompt, v := p.redact(ctx, "continue", "", prompt)
+	out, err := p.Provider.ContinueWriting(ctx, prompt)
+	return restore(v, out, err)
+}
+
+func (p *redactedProvider) PolishText(ctx context.Context, text string) (string, error) {
+	text, v := p.redact(ctx, "polish", "", text)
+	out, err := p.Provider.PolishText(ctx, text)
+	return restore(v, out, err)
+}
+
+func (p *redactedProvider) SummarizeText(ctx context.Context, text string) (string, error) {
+	text, v := p.redact(ctx, "summarize", "", text)
+	out, err := p.Provider.SummarizeText(ctx, text)
+	return restore(v, out, err)
+}
+
+func (p *redactedProvider) Chat(ctx context.Context, message, sessionID string) (string, error) {
+	message, v := p.redact(ctx, "chat", sessionID, message)
+	out, err := p.Provider.Chat(ctx, message, sessionID)
+	return restore(v, out, err)
+}
+
+func (p *redactedProvider) CompleteJSON(ctx context.Context, systemPrompt, prompt string) (string, error) {
+	prompt, v := p.redact(ctx, "proofread", "", prompt)
+	out, err := ai.CompleteJSON(ctx, p.Provider, systemPrompt, prompt)
+	return restore(v, out, err)
+}
+
+func (p *redactedProvider) CallAIStream(ctx context.Context, function, content, sessionID string, writer io.Writer) error {
+	content, v := p.redact(ctx, function, sessionID, content)
+	w := &restoreWriter{v: v, out: writer}
+	err := p.Provider.CallAIStream(ctx, function, content, sessionID, w)
+	w.Flush()
+	return err
+}
+
+// 支持工具调用的提供者：工具结果同样脱敏后再交给模型，模型给出的工具参数还原后再执行
+type redactedToolProvider struct {
+	*redactedProvider
+}
+
+func (p *redactedToolProvider) ChatWithTools(ctx context.Context, message, sessionID string, tools *ai.ToolRegistry, opts ai.ToolOptions) (string, error) {
+	types, names := p.policy(ctx).For(functionFrom(ctx, "chat"))
+	v := sessionVaultFor(ownerFrom(ctx), sessionID)
+	message = v.Redact(message, types, names)
+
+	wrapped := ai.NewToolRegistry()
+	for _, def := range tools.Definitions() {
+		wrapped.Register(def, func(ctx context.Context, args json.RawMessage) (any, error) {
+			result, err := tools.Execute(ctx, ai.ToolCall{Name: def.Name, Arguments: v.Restore(string(args))})
+			if err != nil {
+				return nil, err
+			}
+			redacted := v.Redact(result, types, names)
+			if !json.Valid([]byte(redacted)) {
+				// 替换破坏了JSON结构时（如额外人名中含引号），按纯文本交给模型
+				return redacted, nil
+			}
+			return json.RawMessage(redacted), nil
+		})
+	}
+	if onEvent := opts.OnEvent; onEvent != nil {
+		opts.OnEvent = func(e ai.ToolEvent) {
+			e.Arguments = v.Restore(e.Arguments)
+			e.Result = v.Restore(e.Result)
+			onEvent(e)
+		}
+	}
+
+	out, err := p.Provider.(ai.ToolChatter).ChatWithTools(ctx, message, sessionID, wrapped, opts)
+	return restore(v, out, err)
+}
@@ -0,0 +1,182 @@
+package redact
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"ai-writing-assistant/internal/pkg/ai"
+)
+
+// 脱敏策略
+type Policy struct {
+	Enabled   bool              `json:"enabled"`
+	Types     []Type            `json:"types"`
+	Functions map[string][]Type `json:"functions,omitempty"` // 按功能覆盖脱敏类型，空列表表示该功能不脱敏
+	Names     []string          `json:"names,omitempty"`     // 额外需要脱敏的人名或词语
+}
+
+// 某个功能实际使用的脱敏类型和额外词语，均为空表示该功能不脱敏
+func (p Policy) For(function string) ([]Type, []string) {
+	if !p.Enabled {
+		return nil, nil
+	}
+	if types, ok := p.Functions[function]; ok {
+		if len(types) == 0 {
+			return nil, nil
+		}
+		return types, p.Names
+	}
+	return p.Types, p.Names
+}
+
+// 根据配置生成默认策略
+func PolicyFromConfig(cfg ai.RedactionConfig) (Policy, error) {
+	p := Policy{Enabled: cfg.Enabled, Functions: make(map[string][]Type)}
+	var err error
+	if p.Types, err = ParseTypes(cfg.Types); err != nil {
+		return Policy{}, err
+	}
+	for function, names := range cfg.Functions {
+		if p.Functions[function], err = ParseTypes(names); err != nil {
+			return Policy{}, err
+		}
+	}
+	return p, nil
+}
+
+// 校验并转换脱敏类型
+func ParseTypes(names []string) ([]Type, error) {
+	types := make([]Type, 0, len(names))
+	for _, n := range names {
+		t := Type(strings.ToLower(strings.TrimSpace(n)))
+		if _, ok := placeholderPrefix[t]; !ok {
+			return nil, fmt.Errorf("不支持的脱敏类型: %s", n)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// 占位符格式，如[PHONE_1]
+var placeholderPattern = regexp.MustCompile(`\[(?:PHONE|ID|EMAIL|NAME)_\d+\]`)
+
+// 占位符的最大长度，流式还原时据此判断末尾是否可能是被截断的占位符
+const maxPlaceholderLen = len("[EMAIL_9999]")
+
+// 原值与占位符的对应关系，同一原值始终对应同一占位符
+type Vault struct {
+	mu       sync.Mutex
+	byValue  map[string]string
+	byHolder map[string]string
+	counts   map[Type]int
+}
+
+func NewVault() *Vault {
+	return &Vault{
+		byValue:  make(map[string]string),
+		byHolder: make(map[string]string),
+		counts:   make(map[Type]int),
+	}
+}
+
+// 把文本中检测到的个人信息替换为占位符
+func (v *Vault) Redact(text string, types []Type, names []string) string {
+	spans := Detect(text, types, names)
+	if len(spans) == 0 {
+		return text
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		holder, ok := v.byValue[s.Value]
+		if !ok {
+			v.counts[s.Type]++
+			holder = fmt.Sprintf("[%s_%d]", placeholderPrefix[s.Type], v.counts[s.Type])
+			v.byValue[s.Value] = holder
+			v.byHolder[holder] = s.Value
+		}
+		b.WriteString(text[last:s.Start])
+		b.WriteString(holder)
+		last = s.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// 把文本中的占位符还原为原值，未知的占位符保持原样
+func (v *Vault) Restore(text string) string {
+	if !strings.Contains(text, "[") {
+		return text
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(text, func(holder string) string {
+		if value, ok := v.byHolder[holder]; ok {
+			return value
+		}
+		return holder
+	})
+}
+
+// 流式还原：占位符可能被拆在相邻的两块中，末尾疑似未完整的占位符暂缓写出
+type restoreWriter struct {
+	v       *Vault
+	out     io.Writer
+	pending string
+}
+
+func (w *restoreWriter) Write(p []byte) (int, error) {
+	w.pending += string(p)
+	cut := len(w.pending)
+	if i := strings.LastIndex(w.pending, "["); i >= 0 && !strings.Contains(w.pending[i:], "]") && len(w.pending)-i < maxPlaceholderLen {
+		cut = i
+	}
+	if cut > 0 {
+		if _, err := w.out.Write([]byte(w.v.Restore(w.pending[:cut]))); err != nil {
+			return 0, err
+		}
+		w.pending = w.pending[cut:]
+	}
+	return len(p), nil
+}
+
+// 写出剩余内容
+func (w *restoreWriter) Flush() {
+	if w.pending != "" {
+		w.out.Write([]byte(w.v.Restore(w.pending)))
+		w.pending = ""
+	}
+}
+
+type policyKey struct{}
+
+// 在context上挂载当前用户的脱敏策略
+func WithPolicy(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+func policyFrom(ctx context.Context) (Policy, bool) {
+	p, ok := ctx.Value(policyKey{}).(Policy)
+	return p, ok
+}
+
+type functionKey struct{}
+
+// 标记本次调用对应的功能（continue、polish等），用于选择按功能配置的脱敏类型
+func WithFunction(ctx context.Context, function string) context.Context {
+	return context.WithValue(ctx, functionKey{}, function)
+}
+
+func functionFrom(ctx context.Context, fallback string) string {
+	if f, ok := ctx.Value(functionKey{}).(string); ok && f != "" {
+		return f
+	}
+	return fallback
+}
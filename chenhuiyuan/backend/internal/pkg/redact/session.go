@@ -0,0 +1,77 @@
+package redact
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 会话的对应关系超过该时长未使用后清理，之后同一会话中的旧占位符不再还原
+const sessionTTL = 2 * time.Hour
+
+// 多轮对话的占位符对应关系。会话ID由客户端提供，必须和用户一起作为键，
+// 否则他人带上同一会话ID就能让模型输出的占位符还原成别人的个人信息
+type vaultKey struct {
+	owner   string
+	session string
+}
+
+type sessionVault struct {
+	vault *Vault
+	used  time.Time
+}
+
+var (
+	sessionsMu     sync.Mutex
+	sessions       = make(map[vaultKey]*sessionVault)
+	sessionsPruned time.Time
+)
+
+// owner的sessionID会话的对应关系。没有用户或会话ID时返回不保存的新对应关系
+func sessionVaultFor(owner, sessionID string) *Vault {
+	if owner == "" || sessionID == "" {
+		return NewVault()
+	}
+	now := time.Now()
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if now.Sub(sessionsPruned) > time.Minute {
+		for k, s := range sessions {
+			if now.Sub(s.used) > sessionTTL {
+				delete(sessions, k)
+			}
+		}
+		sessionsPruned = now
+	}
+	key := vaultKey{owner: owner, session: sessionID}
+	s, ok := sessions[key]
+	if !ok {
+		s = &sessionVault{vault: NewVault()}
+		sessions[key] = s
+	}
+	s.used = now
+	return s.vault
+}
+
+// 删除owner全部会话的对应关系，用于删除账号
+func Forget(owner string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for k := range sessions {
+		if k.owner == owner {
+			delete(sessions, k)
+		}
+	}
+}
+
+type ownerKey struct{}
+
+// 在context上标记发起请求的用户，会话的对应关系按用户隔离
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+func ownerFrom(ctx context.Context) string {
+	s, _ := ctx.Value(ownerKey{}).(string)
+	return s
+}
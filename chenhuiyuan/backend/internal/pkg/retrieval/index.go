@@ -0,0 +1,356 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ai-writing-assistant/internal/pkg/logging"
+)
+
+// BM25参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// 启用向量检索时BM25得分与向量相似度的权重
+const vectorWeight = 0.5
+
+// 后台计算一批片段向量的超时时间
+const embedTimeout = time.Minute
+
+// 文本向量计算接口
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// 文档中的一个片段，Start为片段在文档中的字符偏移
+type Passage struct {
+	DocumentID string `json:"documentId"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+	Start      int    `json:"start"`
+}
+
+// 检索结果
+type Result struct {
+	Passage
+	Score float64 `json:"score"`
+}
+
+type chunk struct {
+	Passage
+	tf     map[string]int
+	length int
+	vector []float64
+}
+
+// 单个用户的文档检索索引
+type Index struct {
+	mu        sync.RWMutex
+	embedder  Embedder
+	docs      map[string][]*chunk
+	df        map[string]int
+	chunks    int
+	totalLen  int
+	unembed   map[string]bool // 片段向量待计算的文档
+	embedding bool            // 后台是否正在计算向量
+}
+
+// 创建索引，embedder为nil时仅使用BM25
+func New(embedder Embedder) *Index {
+	return &Index{
+		embedder: embedder,
+		docs:     make(map[string][]*chunk),
+		df:       make(map[string]int),
+		unembed:  make(map[string]bool),
+	}
+}
+
+// 新增或替换文档。配置了向量模型时片段向量在后台计算，内容未变的片段沿用原有向量
+func (ix *Index) Upsert(id, title, content string) {
+	passages := Split(content)
+	chunks := make([]*chunk, 0, len(passages))
+	for _, p := range passages {
+		terms := Tokenize(p.Text)
+		if len(terms) == 0 {
+			continue
+		}
+		tf := make(map[string]int)
+		for _, t := range terms {
+			tf[t]++
+		}
+		p.DocumentID, p.Title = id, title
+		chunks = append(chunks, &chunk{Passage: p, tf: tf, length: len(terms)})
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	vectors := make(map[string][]float64)
+	for _, c := range ix.docs[id] {
+		if c.vector != nil {
+			vectors[c.Text] = c.vector
+		}
+	}
+	ix.remove(id)
+	needEmbed := false
+	for _, c := range chunks {
+		for t := range c.tf {
+			ix.df[t]++
+		}
+		ix.chunks++
+		ix.totalLen += c.length
+		c.vector = vectors[c.Text]
+		needEmbed = needEmbed || c.vector == nil
+	}
+	if len(chunks) > 0 {
+		ix.docs[id] = chunks
+	}
+	if ix.embedder != nil && needEmbed {
+		ix.unembed[id] = true
+		if !ix.embedding {
+			ix.embedding = true
+			go ix.embedPending()
+		}
+	}
+}
+
+// 在后台逐个文档计算缺少向量的片段，直到没有待计算的文档。
+// 同一索引只有一个后台任务，频繁保存同一文档时只计算最新内容
+func (ix *Index) embedPending() {
+	for {
+		ix.mu.Lock()
+		id, ok := "", false
+		for id = range ix.unembed {
+			ok = true
+			break
+		}
+		if !ok {
+			ix.embedding = false
+			ix.mu.Unlock()
+			return
+		}
+		delete(ix.unembed, id)
+		missing := make([]*chunk, 0)
+		texts := make([]string, 0)
+		for _, c := range ix.docs[id] {
+			if c.vector == nil {
+				missing = append(missing, c)
+				texts = append(texts, c.Text)
+			}
+		}
+		ix.mu.Unlock()
+		if len(texts) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), embedTimeout)
+		vectors, err := ix.embedder.Embed(ctx, texts)
+		cancel()
+		if err == nil && len(vectors) != len(texts) {
+			err = errors.New("返回的向量数量与片段数量不一致")
+		}
+		if err != nil {
+			// 未计算向量的片段在检索时只按BM25打分，文档下次保存时重试
+			slog.Warn("计算文档片段向量失败", "document", id, logging.Err(err))
+			continue
+		}
+		// 期间文档被替换时旧片段已不在索引中，写入也不影响检索
+		ix.mu.Lock()
+		for i, c := range missing {
+			c.vector = vectors[i]
+		}
+		ix.mu.Unlock()
+	}
+}
+
+// 删除文档
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id string) {
+	delete(ix.unembed, id)
+	for _, c := range ix.docs[id] {
+		for t := range c.tf {
+			if ix.df[t]--; ix.df[t] <= 0 {
+				delete(ix.df, t)
+			}
+		}
+		ix.chunks--
+		ix.totalLen -= c.length
+	}
+	delete(ix.docs, id)
+}
+
+// 检索与query最相关的k个片段，exclude中的文档不参与检索。
+// 配置了向量模型时，已计算向量的片段混合BM25与向量相似度，
+// 向量尚未算好的片段和query向量计算失败时只按BM25打分
+func (ix *Index) Search(ctx context.Context, query string, k int, exclude ...string) []Result {
+	terms := Tokenize(query)
+	if len(terms) == 0 || k <= 0 {
+		return nil
+	}
+	skip := make(map[string]bool, len(exclude))
+	for _, id := range exclude {
+		skip[id] = true
+	}
+
+	ix.mu.RLock()
+	candidates := make([]*chunk, 0)
+	for id, chunks := range ix.docs {
+		if !skip[id] {
+			candidates = append(candidates, chunks...)
+		}
+	}
+	scores := make([]float64, len(candidates))
+	maxScore := 0.0
+	for i, c := range candidates {
+		scores[i] = ix.bm25(terms, c)
+		maxScore = math.Max(maxScore, scores[i])
+	}
+	ix.mu.RUnlock()
+
+	if maxScore > 0 {
+		for i := range scores {
+			scores[i] /= maxScore
+		}
+	}
+	if sims, ok := ix.similarities(ctx, query, candidates); ok {
+		for i := range scores {
+			if sims[i] >= 0 {
+				scores[i] = (1-vectorWeight)*scores[i] + vectorWeight*sims[i]
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(candidates))
+	for i, c := range candidates {
+		if scores[i] > 0 {
+			results = append(results, Result{Passage: c.Passage, Score: scores[i]})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+func (ix *Index) bm25(terms []string, c *chunk) float64 {
+	avgLen := float64(ix.totalLen) / float64(ix.chunks)
+	score := 0.0
+	for _, t := range terms {
+		f := float64(c.tf[t])
+		if f == 0 {
+			continue
+		}
+		n := float64(ix.df[t])
+		idf := math.Log(1 + (float64(ix.chunks)-n+0.5)/(n+0.5))
+		score += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(c.length)/avgLen))
+	}
+	return score
+}
+
+// 计算query与各候选片段的余弦相似度，只使用已在后台算好的片段向量，
+// 没有向量的片段返回-1。检索时只为query计算一次向量
+func (ix *Index) similarities(ctx context.Context, query string, candidates []*chunk) ([]float64, bool) {
+	if ix.embedder == nil || len(candidates) == 0 {
+		return nil, false
+	}
+
+	ix.mu.RLock()
+	sims := make([]float64, len(candidates))
+	vectors := make([][]float64, len(candidates))
+	embedded := false
+	for i, c := range candidates {
+		vectors[i] = c.vector
+		embedded = embedded || c.vector != nil
+	}
+	ix.mu.RUnlock()
+	if !embedded {
+		return nil, false
+	}
+
+	q, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil || len(q) != 1 {
+		return nil, false
+	}
+	for i, v := range vectors {
+		if v == nil {
+			sims[i] = -1
+			continue
+		}
+		sims[i] = math.Max(0, cosine(q[0], v))
+	}
+	return sims, true
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// 检索用的分词：连续字母数字转小写作为一个词，
+// 汉字、假名、谚文等按相邻两字切分（单字片段保留单字）
+func Tokenize(text string) []string {
+	terms := make([]string, 0, len(text)/3)
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			terms = append(terms, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			terms = append(terms, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
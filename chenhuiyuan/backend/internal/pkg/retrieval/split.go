@@ -0,0 +1,66 @@
+package retrieval
+
+import "strings"
+
+// 片段的目标长度（字符数），超长段落按句子切分
+const (
+	passageRunes    = 300
+	maxPassageRunes = 500
+)
+
+// 句子结束符
+const sentenceEnds = "。！？.!?"
+
+// 按段落把文档切分为检索片段：相邻短段落合并到约passageRunes字，
+// 超过maxPassageRunes的段落在句子边界处切开
+func Split(content string) []Passage {
+	runes := []rune(content)
+	passages := make([]Passage, 0, len(runes)/passageRunes+1)
+	start, end := -1, 0
+	flush := func() {
+		if start >= 0 {
+			text := strings.TrimSpace(string(runes[start:end]))
+			if text != "" {
+				passages = append(passages, Passage{Text: text, Start: start})
+			}
+			start = -1
+		}
+	}
+
+	for i := 0; i < len(runes); {
+		// 取出一个段落[i, j)
+		j := i
+		for j < len(runes) && runes[j] != '\n' {
+			j++
+		}
+		for _, seg := range splitLong(runes, i, j) {
+			if start >= 0 && seg[1]-start > passageRunes {
+				flush()
+			}
+			if start < 0 {
+				start = seg[0]
+			}
+			end = seg[1]
+		}
+		i = j + 1
+	}
+	flush()
+	return passages
+}
+
+// 把超长段落在句子边界处切成不超过maxPassageRunes的若干段，返回各段的起止偏移
+func splitLong(runes []rune, start, end int) [][2]int {
+	segs := make([][2]int, 0, 1)
+	for end-start > maxPassageRunes {
+		cut := start + maxPassageRunes
+		for k := cut - 1; k > start+passageRunes/2; k-- {
+			if strings.ContainsRune(sentenceEnds, runes[k]) {
+				cut = k + 1
+				break
+			}
+		}
+		segs = append(segs, [2]int{start, cut})
+		start = cut
+	}
+	return append(segs, [2]int{start, end})
+}
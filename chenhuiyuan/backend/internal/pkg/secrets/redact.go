@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 短于此长度的值不做替换，避免误伤普通文本
+const minTrackedLen = 8
+
+var (
+	trackedMu sync.RWMutex
+	tracked   = make(map[string]string) // 密钥值 -> 显示名称
+	replacer  *strings.Replacer
+	maxLen    int // 最长密钥值的字节数
+)
+
+// 登记需要在日志和响应中隐藏的密钥值。轮换后旧值仍保留，
+// 以免进行中的请求或迟到的日志泄露旧密钥
+func Track(label, value string) {
+	if len(value) < minTrackedLen {
+		return
+	}
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+	if tracked[value] == "[secret:"+label+"]" {
+		return
+	}
+	tracked[value] = "[secret:" + label + "]"
+	maxLen = max(maxLen, len(value))
+
+	// 较长的值优先替换，避免一个密钥是另一个的前缀时替换不完整
+	values := make([]string, 0, len(tracked))
+	for v := range tracked {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, k int) bool { return len(values[i]) > len(values[k]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, tracked[v])
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// 把字符串中已登记的密钥值替换为[secret:名称]
+func Redact(s string) string {
+	trackedMu.RLock()
+	r := replacer
+	trackedMu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// s末尾可能是某个密钥值开头的最长部分的字节数。分多次写出时这部分暂不写出，
+// 等后续内容确认不会与之组成完整的密钥值后再替换写出
+func PartialLen(s string) int {
+	trackedMu.RLock()
+	defer trackedMu.RUnlock()
+	for i := max(len(s)-maxLen+1, 0); i < len(s); i++ {
+		for v := range tracked {
+			if strings.HasPrefix(v, s[i:]) {
+				return len(s) - i
+			}
+		}
+	}
+	return 0
+}
+
+// 写入前隐藏密钥的Writer，用于日志输出
+func NewWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
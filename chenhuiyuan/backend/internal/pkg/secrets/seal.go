@@ -0,0 +1,146 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// 主密钥所在的环境变量
+const MasterKeyEnv = "SECRETS_MASTER_KEY"
+
+// 加密文件首行，第二行为base64编码的 盐(16字节)|nonce(12字节)|密文
+const fileHeader = "# ai-writing-assistant secrets v1: AES-256-GCM, key derived from $" + MasterKeyEnv
+
+const saltSize = 16
+
+var ErrWrongKey = errors.New("主密钥错误或密钥文件已损坏")
+
+// 由主密钥和盐派生AES-256密钥
+func deriveKey(masterKey string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(masterKey), salt, 1<<15, 8, 1, 32)
+}
+
+// 加密密钥表，每次使用新的盐和nonce
+func Seal(values map[string]string, masterKey string) ([]byte, error) {
+	if masterKey == "" {
+		return nil, fmt.Errorf("未设置%s", MasterKeyEnv)
+	}
+	plain, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(masterKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	blob := append(salt, nonce...)
+	blob = gcm.Seal(blob, nonce, plain, []byte(fileHeader))
+	var buf bytes.Buffer
+	buf.WriteString(fileHeader + "\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(blob) + "\n")
+	return buf.Bytes(), nil
+}
+
+// 解密Seal生成的内容
+func Unseal(data []byte, masterKey string) (map[string]string, error) {
+	if masterKey == "" {
+		return nil, fmt.Errorf("未设置%s，无法解密密钥文件", MasterKeyEnv)
+	}
+	header, body, _ := strings.Cut(string(data), "\n")
+	if strings.TrimSpace(header) != fileHeader {
+		return nil, errors.New("不是有效的密钥文件")
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(body))
+	if err != nil || len(blob) < saltSize {
+		return nil, errors.New("不是有效的密钥文件")
+	}
+	salt, blob := blob[:saltSize], blob[saltSize:]
+	gcm, err := newGCM(masterKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < gcm.NonceSize() {
+		return nil, errors.New("不是有效的密钥文件")
+	}
+	nonce, ciphertext := blob[:gcm.NonceSize()], blob[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, []byte(fileHeader))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+
+	values := make(map[string]string)
+	if err := yaml.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+	return values, nil
+}
+
+func newGCM(masterKey string, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(masterKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 读取并解密密钥文件
+func ReadFile(path, masterKey string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := Unseal(data, masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// 加密并写入密钥文件，先写临时文件再替换，避免服务读到写了一半的文件
+func WriteFile(path string, values map[string]string, masterKey string) error {
+	data, err := Seal(values, masterKey)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".secrets-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
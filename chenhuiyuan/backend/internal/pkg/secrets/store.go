@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 配置中引用密钥的前缀，如 api_key: "secret:deepseek_api_key"
+const RefPrefix = "secret:"
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// 密钥名只能包含字母、数字、下划线、点和连字符
+func ValidName(name string) bool {
+	return namePattern.MatchString(name) && !strings.HasPrefix(name, ".")
+}
+
+// 解析配置值中的密钥引用
+func ParseRef(value string) (string, bool) {
+	return strings.CutPrefix(value, RefPrefix)
+}
+
+// 密钥来源：加密文件和/或编排系统挂载的目录（每个文件一个密钥，文件名即密钥名）
+type Sources struct {
+	File      string
+	Dir       string
+	MasterKey string
+}
+
+// 按名称读取的密钥集合，加载后只读
+type Store struct {
+	values map[string]string
+}
+
+// 从全部来源读取密钥，目录中的同名密钥覆盖加密文件中的。
+// 未创建的文件或目录视为没有密钥，返回的files为需要监视变化的路径
+func Open(src Sources) (store *Store, files []string, err error) {
+	store = &Store{values: make(map[string]string)}
+
+	if src.File != "" {
+		files = append(files, src.File)
+		values, err := ReadFile(src.File, src.MasterKey)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, files, err
+		}
+		for name, v := range values {
+			store.values[name] = v
+		}
+	}
+
+	if src.Dir != "" {
+		files = append(files, src.Dir)
+		entries, err := os.ReadDir(src.Dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, files, fmt.Errorf("读取密钥目录失败: %w", err)
+		}
+		for _, e := range entries {
+			// 跳过Kubernetes用于原子更新的..data等隐藏项
+			if !ValidName(e.Name()) {
+				continue
+			}
+			path := filepath.Join(src.Dir, e.Name())
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, files, fmt.Errorf("读取密钥失败: %w", err)
+			}
+			store.values[e.Name()] = strings.TrimRight(string(data), "\r\n")
+			files = append(files, path)
+		}
+	}
+	return store, files, nil
+}
+
+// 按名称获取密钥
+func (s *Store) Get(name string) (string, bool) {
+	v, ok := s.values[name]
+	return v, ok
+}
@@ -0,0 +1,344 @@
+package style
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 句子结束符
+const sentenceEnds = "。！？!?…\n"
+
+// 样例片段的长度范围（字符数）
+const (
+	minExcerptRunes = 30
+	maxExcerptRunes = 150
+)
+
+// 风格统计结果
+type Metrics struct {
+	Documents          int     `json:"documents"`
+	Characters         int     `json:"characters"`
+	Sentences          int     `json:"sentences"`
+	AvgSentenceLength  float64 `json:"avgSentenceLength"`  // 平均句长（字符）
+	ShortSentenceRatio float64 `json:"shortSentenceRatio"` // 15字以内短句占比
+	LongSentenceRatio  float64 `json:"longSentenceRatio"`  // 40字以上长句占比
+	AvgParagraphLength float64 `json:"avgParagraphLength"` // 平均段落长度（字符）
+	LexicalDiversity   float64 `json:"lexicalDiversity"`   // 词汇丰富度（不同词数/总词数）
+	ExclamationRatio   float64 `json:"exclamationRatio"`   // 感叹句占比
+	QuestionRatio      float64 `json:"questionRatio"`      // 疑问句占比
+	ColloquialPerK     float64 `json:"colloquialPerK"`     // 每千字口语词数
+	LiteraryPerK       float64 `json:"literaryPerK"`       // 每千字书面语词数
+	FirstPersonPerK    float64 `json:"firstPersonPerK"`    // 每千字第一人称数
+	EnglishWordRatio   float64 `json:"englishWordRatio"`   // 英文单词占比
+	PunctuationDensity float64 `json:"punctuationDensity"` // 每百字标点数
+	DialogueRatio      float64 `json:"dialogueRatio"`      // 含引号对话的句子占比
+}
+
+// 风格分析结果
+type Profile struct {
+	Metrics    Metrics  `json:"metrics"`
+	Tone       []string `json:"tone"`       // 语气特征描述
+	Vocabulary []string `json:"vocabulary"` // 常用词
+	Excerpts   []string `json:"excerpts"`   // 代表性片段
+}
+
+// 口语化和书面化的标志词
+var (
+	colloquialWords = []string{"吧", "呢", "啊", "呀", "嘛", "哈", "咱", "挺", "特别", "其实", "反正", "有点", "好像", "真的", "超级"}
+	literaryWords   = []string{"之", "其", "此", "乃", "亦", "然而", "因此", "鉴于", "综上", "与此同时", "诚然", "倘若", "予以", "进而"}
+	firstPerson     = []string{"我", "我们", "咱们", "笔者", "本人"}
+)
+
+// 高频但不体现风格的词，统计常用词时忽略
+var stopwords = map[string]bool{
+	"的": true, "了": true, "是": true, "在": true, "和": true, "也": true, "就": true, "都": true,
+	"而": true, "及": true, "与": true, "着": true, "或": true, "一个": true, "没有": true, "我们": true,
+	"你们": true, "他们": true, "这个": true, "那个": true, "什么": true, "自己": true, "可以": true,
+	"the": true, "and": true, "of": true, "to": true, "a": true, "in": true, "is": true, "it": true,
+}
+
+// 根据多篇文档统计写作风格
+func Analyze(texts []string) Profile {
+	var m Metrics
+	var sentences []string
+	var paragraphs int
+	var paragraphRunes int
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		m.Documents++
+		m.Characters += countNonSpace(text)
+		for _, p := range strings.Split(text, "\n") {
+			if p = strings.TrimSpace(p); p != "" {
+				paragraphs++
+				paragraphRunes += utf8.RuneCountInString(p)
+			}
+		}
+		sentences = append(sentences, splitSentences(text)...)
+	}
+	if m.Characters == 0 {
+		return Profile{Metrics: m}
+	}
+
+	m.Sentences = len(sentences)
+	if paragraphs > 0 {
+		m.AvgParagraphLength = round(float64(paragraphRunes) / float64(paragraphs))
+	}
+
+	var totalLen, short, long, exclaim, question, dialogue int
+	for _, s := range sentences {
+		n := utf8.RuneCountInString(s)
+		totalLen += n
+		if n <= 15 {
+			short++
+		}
+		if n >= 40 {
+			long++
+		}
+		switch {
+		case strings.HasSuffix(s, "！") || strings.HasSuffix(s, "!"):
+			exclaim++
+		case strings.HasSuffix(s, "？") || strings.HasSuffix(s, "?"):
+			question++
+		}
+		if strings.ContainsAny(s, "“”「」\"") {
+			dialogue++
+		}
+	}
+	if m.Sentences > 0 {
+		total := float64(m.Sentences)
+		m.AvgSentenceLength = round(float64(totalLen) / total)
+		m.ShortSentenceRatio = round(float64(short) / total)
+		m.LongSentenceRatio = round(float64(long) / total)
+		m.ExclamationRatio = round(float64(exclaim) / total)
+		m.QuestionRatio = round(float64(question) / total)
+		m.DialogueRatio = round(float64(dialogue) / total)
+	}
+
+	all := strings.Join(texts, "\n")
+	perK := 1000 / float64(m.Characters)
+	m.ColloquialPerK = round(float64(countAll(all, colloquialWords)) * perK)
+	m.LiteraryPerK = round(float64(countAll(all, literaryWords)) * perK)
+	m.FirstPersonPerK = round(float64(countAll(all, firstPerson)) * perK)
+	m.PunctuationDensity = round(float64(countPunct(all)) * 100 / float64(m.Characters))
+
+	words := tokenize(all)
+	freq := make(map[string]int)
+	english := 0
+	for _, w := range words {
+		freq[w]++
+		if w[0] < utf8.RuneSelf {
+			english++
+		}
+	}
+	if len(words) > 0 {
+		m.LexicalDiversity = round(float64(len(freq)) / float64(len(words)))
+		m.EnglishWordRatio = round(float64(english) / float64(len(words)))
+	}
+
+	return Profile{
+		Metrics:    m,
+		Tone:       describeTone(m),
+		Vocabulary: topWords(freq, 20),
+		Excerpts:   pickExcerpts(sentences, m.AvgSentenceLength, 3),
+	}
+}
+
+// 根据统计结果给出语气特征描述
+func describeTone(m Metrics) []string {
+	tone := make([]string, 0, 4)
+	switch {
+	case m.AvgSentenceLength < 15:
+		tone = append(tone, "短句为主，节奏明快")
+	case m.AvgSentenceLength > 35:
+		tone = append(tone, "长句较多，叙述绵密")
+	default:
+		tone = append(tone, "长短句搭配适中")
+	}
+	switch {
+	case m.ColloquialPerK > m.LiteraryPerK*1.5 && m.ColloquialPerK >= 3:
+		tone = append(tone, "口语化、亲切随和")
+	case m.LiteraryPerK > m.ColloquialPerK*1.5 && m.LiteraryPerK >= 3:
+		tone = append(tone, "书面化、正式严谨")
+	default:
+		tone = append(tone, "语体介于口语与书面语之间")
+	}
+	if m.FirstPersonPerK >= 5 {
+		tone = append(tone, "常以第一人称叙述")
+	}
+	if m.ExclamationRatio >= 0.1 {
+		tone = append(tone, "情绪表达较强烈")
+	}
+	if m.QuestionRatio >= 0.1 {
+		tone = append(tone, "善用设问与读者互动")
+	}
+	if m.DialogueRatio >= 0.2 {
+		tone = append(tone, "对话描写较多")
+	}
+	return tone
+}
+
+// 按句子结束符切分，保留结束符
+func splitSentences(text string) []string {
+	sentences := make([]string, 0)
+	var b strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			sentences = append(sentences, s)
+		}
+		b.Reset()
+	}
+	for _, r := range text {
+		if r != '\n' {
+			b.WriteRune(r)
+		}
+		if strings.ContainsRune(sentenceEnds, r) {
+			flush()
+		}
+	}
+	flush()
+	return sentences
+}
+
+// 常用词统计的分词：中文按两字词切分，英文按单词切分，忽略停用词
+func tokenize(text string) []string {
+	words := make([]string, 0, len(text)/3)
+	var han, latin []rune
+	flushHan := func() {
+		for i := 0; i+1 < len(han); i++ {
+			// 含虚词的两字组合多为跨词切分，不计入
+			if !stopwords[string(han[i])] && !stopwords[string(han[i+1])] {
+				words = appendWord(words, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	flushLatin := func() {
+		if len(latin) > 1 {
+			words = appendWord(words, strings.ToLower(string(latin)))
+		}
+		latin = latin[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushLatin()
+			han = append(han, r)
+		case unicode.IsLetter(r):
+			flushHan()
+			latin = append(latin, r)
+		default:
+			flushHan()
+			flushLatin()
+		}
+	}
+	flushHan()
+	flushLatin()
+	return words
+}
+
+func appendWord(words []string, w string) []string {
+	if stopwords[w] {
+		return words
+	}
+	return append(words, w)
+}
+
+// 取出现次数最多的n个词（至少出现两次）
+func topWords(freq map[string]int, n int) []string {
+	words := make([]string, 0, len(freq))
+	for w, c := range freq {
+		if c >= 2 {
+			words = append(words, w)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if freq[words[i]] != freq[words[j]] {
+			return freq[words[i]] > freq[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
+
+// 选取长度接近平均句长两倍的若干片段作为风格样例，相邻句子合并到合适长度，样例之间不重叠
+func pickExcerpts(sentences []string, avg float64, n int) []string {
+	type candidate struct {
+		text       string
+		first, end int
+		dist       float64
+	}
+	target := math.Max(avg*2, minExcerptRunes)
+	candidates := make([]candidate, 0)
+	for i := range sentences {
+		text, j := sentences[i], i+1
+		for ; j < len(sentences) && utf8.RuneCountInString(text) < minExcerptRunes; j++ {
+			text += sentences[j]
+		}
+		length := utf8.RuneCountInString(text)
+		if length < minExcerptRunes || length > maxExcerptRunes {
+			continue
+		}
+		candidates = append(candidates, candidate{text: text, first: i, end: j, dist: math.Abs(float64(length) - target)})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+
+	used := make([]bool, len(sentences))
+	excerpts := make([]string, 0, n)
+	for _, c := range candidates {
+		if len(excerpts) == n {
+			break
+		}
+		overlap := false
+		for k := c.first; k < c.end; k++ {
+			overlap = overlap || used[k]
+		}
+		if overlap {
+			continue
+		}
+		for k := c.first; k < c.end; k++ {
+			used[k] = true
+		}
+		excerpts = append(excerpts, c.text)
+	}
+	return excerpts
+}
+
+func countAll(text string, words []string) int {
+	n := 0
+	for _, w := range words {
+		n += strings.Count(text, w)
+	}
+	return n
+}
+
+func countNonSpace(text string) int {
+	n := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func countPunct(text string) int {
+	n := 0
+	for _, r := range text {
+		if unicode.IsPunct(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,300 @@
+package textdiff
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// 编辑类型
+type EditType string
+
+const (
+	Insert  EditType = "insert"
+	Delete  EditType = "delete"
+	Replace EditType = "replace"
+)
+
+// 一处编辑，Start/End为原文中的UTF-16码元偏移（与前端JavaScript字符串的下标一致，
+// 基本平面以外的字符如emoji占2个单位），左闭右开；插入时Start等于End
+type Edit struct {
+	ID       int      `json:"id"`
+	Type     EditType `json:"type"`
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	Original string   `json:"original"`
+	Text     string   `json:"text"`
+	Reason   string   `json:"reason"`
+}
+
+// 差异计算的最大编辑距离（按词元计），超出时整体视为一处替换
+const maxEditDistance = 2000
+
+// 计算从original到revised的编辑列表
+func Compute(original, revised string) []Edit {
+	a, b := Tokenize(original), Tokenize(revised)
+
+	// 去掉公共前缀和后缀，缩小差异计算范围
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	ops, ok := myers(midA, midB)
+	if !ok {
+		ops = make([]op, 0, len(midA)+len(midB))
+		for _, t := range midA {
+			ops = append(ops, op{kind: opDelete, token: t})
+		}
+		for _, t := range midB {
+			ops = append(ops, op{kind: opInsert, token: t})
+		}
+	}
+
+	pos := 0
+	for _, t := range a[:prefix] {
+		pos += utf16Len(t)
+	}
+	return buildEdits(ops, pos)
+}
+
+// 按CJK友好的粒度切分文本：汉字、假名、谚文逐字切分，
+// 连续的字母数字作为一个词，连续空白作为一个词元，其余符号逐个切分
+func Tokenize(s string) []string {
+	tokens := make([]string, 0, len(s)/2)
+	start := -1
+	class := 0
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, s[start:end])
+			start = -1
+		}
+	}
+	for i, r := range s {
+		c := runeClass(r)
+		if c == classSingle {
+			flush(i)
+			tokens = append(tokens, string(r))
+			continue
+		}
+		if start >= 0 && c != class {
+			flush(i)
+		}
+		if start < 0 {
+			start = i
+			class = c
+		}
+	}
+	flush(len(s))
+	return tokens
+}
+
+const (
+	classSingle = iota
+	classWord
+	classSpace
+)
+
+func runeClass(r rune) int {
+	switch {
+	case isCJK(r):
+		return classSingle
+	case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+		return classWord
+	case unicode.IsSpace(r):
+		return classSpace
+	default:
+		return classSingle
+	}
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind  opKind
+	token string
+}
+
+// Myers差异算法，编辑距离超过maxEditDistance时返回false
+func myers(a, b []string) ([]op, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+	if max > maxEditDistance*2 {
+		max = maxEditDistance * 2
+	}
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d]保存第d步开始前v在[-d, d]范围内的取值
+	trace := make([][]int, 0)
+
+	found := false
+	for d := 0; d <= max && d <= maxEditDistance; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// 回溯得到逆序的操作序列
+	rev := make([]op, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		var prevX int
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, op{kind: opEqual, token: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, op{kind: opInsert, token: b[y-1]})
+			} else {
+				rev = append(rev, op{kind: opDelete, token: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]op, len(rev))
+	for i := range rev {
+		ops[i] = rev[len(rev)-1-i]
+	}
+	return ops, true
+}
+
+// 将连续的删除和插入合并为编辑，pos为操作序列在原文中的起始UTF-16偏移
+func buildEdits(ops []op, pos int) []Edit {
+	edits := make([]Edit, 0)
+	var del, ins strings.Builder
+	start := pos
+	flush := func() {
+		if del.Len() == 0 && ins.Len() == 0 {
+			return
+		}
+		e := Edit{
+			ID:       len(edits) + 1,
+			Start:    start,
+			End:      pos,
+			Original: del.String(),
+			Text:     ins.String(),
+		}
+		switch {
+		case del.Len() == 0:
+			e.Type = Insert
+		case ins.Len() == 0:
+			e.Type = Delete
+		default:
+			e.Type = Replace
+		}
+		e.Reason = reasonFor(e)
+		edits = append(edits, e)
+		del.Reset()
+		ins.Reset()
+	}
+
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			flush()
+			pos += utf16Len(o.token)
+			start = pos
+		case opDelete:
+			del.WriteString(o.token)
+			pos += utf16Len(o.token)
+		case opInsert:
+			ins.WriteString(o.token)
+		}
+	}
+	flush()
+	return edits
+}
+
+// s编码为UTF-16后的码元数
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// 根据改动内容给出简短的修改说明
+func reasonFor(e Edit) string {
+	changed := e.Original + e.Text
+	switch {
+	case strings.TrimSpace(changed) == "":
+		return "调整空白"
+	case onlyPunct(changed):
+		return "调整标点"
+	case e.Type == Insert:
+		return "补充表达"
+	case e.Type == Delete:
+		return "删除冗余内容"
+	default:
+		return "优化措辞"
+	}
+}
+
+func onlyPunct(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPunct(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,14 +1,175 @@
 package utils
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"ai-writing-assistant/internal/pkg/logging"
 )
 
-func MustStartServer(handler http.Handler) {
-	addr := ":8080"
-	log.Printf("server listening on %s", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatal(err)
+// HTTP服务选项，超时为0表示不限制
+type ServerOptions struct {
+	Addr              string
+	CertFile          string // 同时配置证书和私钥时启用HTTPS，文件更新后自动重新加载
+	KeyFile           string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration // 限制整个响应的写入时长，流式接口需留足时间
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // 停止时等待进行中请求（含流式响应）和OnShutdown结束的总时长
+
+	// HTTP服务停止后调用，ctx与等待请求共用同一个截止时间，用于等待后台任务
+	OnShutdown func(ctx context.Context)
+}
+
+// 启动HTTP服务并阻塞到ctx结束。ctx结束后停止接收新请求，等待进行中的请求完成；
+// 超过ShutdownTimeout仍未完成的请求会被取消并强制关闭连接，OnShutdown只能使用剩余的时间
+func RunServer(ctx context.Context, handler http.Handler, opts ServerOptions) error {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return errors.New("TLS证书和私钥需同时配置")
+	}
+
+	// 所有请求的ctx都派生自baseCtx，排空超时后取消以中断仍在生成的流式响应
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	srv := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+
+	tlsEnabled := opts.CertFile != ""
+	if tlsEnabled {
+		certs, err := newCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return err
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsEnabled {
+			slog.Info("服务已启动", "addr", "https://"+ln.Addr().String())
+			serveErr <- srv.ServeTLS(ln, "", "")
+		} else {
+			slog.Info("服务已启动", "addr", "http://"+ln.Addr().String())
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("正在停止服务，等待进行中的请求完成", "timeout", opts.ShutdownTimeout.String())
+	shutdownCtx := context.Background()
+	if opts.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, opts.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("等待请求完成超时，强制关闭剩余连接", logging.Err(err))
+		cancelBase()
+		srv.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	if opts.OnShutdown != nil {
+		opts.OnShutdown(shutdownCtx)
+	}
+	slog.Info("服务已停止")
+	return nil
+}
+
+// 按修改时间重新加载证书，续期后无需重启服务
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // 证书和私钥中较新的修改时间
+	checked time.Time
+}
+
+// 两次检查文件修改时间的最小间隔
+const certCheckInterval = 10 * time.Second
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= certCheckInterval {
+		r.checked = time.Now()
+		if modTime, err := r.latestModTime(); err != nil {
+			slog.Warn("检查TLS证书失败，继续使用原证书", logging.Err(err))
+		} else if modTime.After(r.modTime) {
+			if err := r.load(modTime); err != nil {
+				slog.Warn("重新加载TLS证书失败，继续使用原证书", logging.Err(err))
+			} else {
+				slog.Info("已重新加载TLS证书", "file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("读取TLS证书失败: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// 加载证书，调用方需持有r.mu（初次加载除外）
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载TLS证书失败: %w", err)
 	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = time.Now()
+	return nil
 }
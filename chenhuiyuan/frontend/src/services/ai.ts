@@ -1,4 +1,4 @@
-import { getHttpClient } from './api'
+import { getHttpClient, refreshAccessToken, redirectToLogin } from './api'
 import type { AiFunctionType, AiRequestParams, AiResult, TextSelection } from '@/types'
 
 export type AiContinueRequest = { prompt: string }
@@ -23,18 +23,6 @@ export type ModelsResponse = {
 	current: string
 }
 
-// 模型切换请求
-export type SwitchModelRequest = {
-	modelName: string
-}
-
-// 模型切换响应
-export type SwitchModelResponse = {
-	success: boolean
-	message: string
-	modelName: string
-}
-
 // 新的统一AI接口
 export type UnifiedAiRequest = {
 	functionType: AiFunctionType
@@ -70,6 +58,9 @@ export type ChatResponse = {
 // 流式AI回调函数类型
 export type StreamCallback = (chunk: string, isComplete: boolean) => void
 
+// 流式响应中具名事件（如翻译的术语校验结果）的回调函数类型
+export type StreamEventCallback = (event: string, data: any) => void
+
 // 智能内容选择函数
 export function getSmartTextSelection(
   fullText: string,
@@ -137,12 +128,6 @@ export async function getAvailableModels(): Promise<ModelsResponse> {
 	return res.data
 }
 
-// 切换AI模型
-export async function switchModel(modelName: string): Promise<SwitchModelResponse> {
-	const res = await getHttpClient().post<SwitchModelResponse>('/ai/switch-model', { modelName })
-	return res.data
-}
-
 // 多轮对话接口
 export async function chat(data: ChatRequest): Promise<ChatResponse> {
 	const res = await getHttpClient().post<ChatResponse>('/ai/chat', data)
@@ -152,17 +137,15 @@ export async function chat(data: ChatRequest): Promise<ChatResponse> {
 // 流式统一AI接口
 export async function callUnifiedAIStream(
   data: UnifiedAiRequest, 
-  callback: StreamCallback
+  callback: StreamCallback,
+  onEvent?: StreamEventCallback
 ): Promise<void> {
   try {
     // 在开发环境中，vite代理会将/api转发到http://localhost:8080
     // 在生产环境中，应该设置正确的API基础URL
     const apiUrl = '/api/ai/unified'
     
-    // 获取认证token，与api.ts保持一致
-    const token = localStorage.getItem('auth-token') || ''
-    
-    const response = await fetch(apiUrl, {
+    const send = (token: string) => fetch(apiUrl, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -177,6 +160,17 @@ export async function callUnifiedAIStream(
       })
     })
 
+    // 获取认证token，与api.ts保持一致；访问令牌过期时刷新后重试一次
+    let response = await send(localStorage.getItem('auth-token') || '')
+    if (response.status === 401 && localStorage.getItem('auth-refresh-token')) {
+      try {
+        response = await send(await refreshAccessToken())
+      } catch (e) {
+        redirectToLogin()
+        throw new Error('登录已过期，请重新登录')
+      }
+    }
+
     if (!response.ok) {
       throw new Error(`HTTP error! status: ${response.status}`)
     }
@@ -188,6 +182,7 @@ export async function callUnifiedAIStream(
 
     const decoder = new TextDecoder()
     let buffer = ''
+    let eventName = '' // 当前SSE事件名，为空表示正文内容
 
     while (true) {
       const { done, value } = await reader.read()
@@ -198,6 +193,23 @@ export async function callUnifiedAIStream(
       buffer = lines.pop() || ''
 
       for (const line of lines) {
+        if (line === '') {
+          eventName = ''
+          continue
+        }
+        if (line.startsWith('event:')) {
+          eventName = line.slice(6).trim()
+          continue
+        }
+        // 具名事件携带的是结构化数据，不作为正文内容
+        if (eventName && line.startsWith('data:')) {
+          try {
+            onEvent?.(eventName, JSON.parse(line.slice(5)))
+          } catch (e) {
+            // 忽略无法解析的事件数据
+          }
+          continue
+        }
         if (line.startsWith('data: ')) {
           const data = line.slice(6)
           if (data === '[DONE]') {
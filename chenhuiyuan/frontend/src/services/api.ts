@@ -1,11 +1,32 @@
-import axios, { type AxiosInstance, type AxiosResponse, type AxiosError } from 'axios'
+import axios, { type AxiosInstance, type AxiosResponse, type AxiosError, type InternalAxiosRequestConfig } from 'axios'
 import { useAuthStore } from '@/stores/auth'
 import { ElMessage } from 'element-plus'
 
-const BASE_URL = import.meta.env.VITE_API_BASE_URL || '/api'
+export const BASE_URL = import.meta.env.VITE_API_BASE_URL || '/api'
 
 let httpClient: AxiosInstance | null = null
 
+// 进行中的刷新，访问令牌过期时并发的请求共用同一次刷新
+let refreshing: Promise<string> | null = null
+
+// 用刷新令牌换取新的访问令牌，失败时已退出登录
+export function refreshAccessToken(): Promise<string> {
+  if (!refreshing) {
+    refreshing = useAuthStore().refreshSession().finally(() => {
+      refreshing = null
+    })
+  }
+  return refreshing
+}
+
+// 刷新失败后回到登录页
+export function redirectToLogin() {
+  window.location.assign(`${import.meta.env.BASE_URL}login`)
+}
+
+// 这些接口的401不是访问令牌过期，不需要刷新
+const noRefreshPaths = ['/auth/login', '/auth/register', '/auth/refresh']
+
 export function getHttpClient(): AxiosInstance {
   if (httpClient) return httpClient
   httpClient = axios.create({
@@ -26,7 +47,25 @@ export function getHttpClient(): AxiosInstance {
   })
   httpClient.interceptors.response.use(
     (res: AxiosResponse) => res,
-    (err: AxiosError) => {
+    async (err: AxiosError) => {
+      // 访问令牌过期时刷新后重试一次
+      const config = err.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined
+      if (err.response?.status === 401 && config && !config._retried && !noRefreshPaths.includes(config.url || '')) {
+        const store = useAuthStore()
+        if (store.refreshToken) {
+          config._retried = true
+          try {
+            const token = await refreshAccessToken()
+            ;(config.headers as Record<string, string>)['Authorization'] = token
+            return httpClient!(config)
+          } catch (e) {
+            ElMessage.error('登录已过期，请重新登录')
+            redirectToLogin()
+            return Promise.reject(err)
+          }
+        }
+      }
+
       // 统一错误处理
       let errorMessage = '请求失败'
       
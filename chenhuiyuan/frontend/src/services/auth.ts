@@ -1,12 +1,27 @@
-import { getHttpClient } from './api'
+import axios from 'axios'
+import { getHttpClient, BASE_URL } from './api'
+
+// 登录和刷新接口返回的令牌
+export type TokenPair = {
+  token: string
+  refreshToken: string
+  expiresIn: number // 访问令牌有效秒数
+}
 
 export async function register(username: string, password: string): Promise<{ ok: boolean }> {
   const res = await getHttpClient().post('/auth/register', { username, password })
   return res.data
 }
 
-export async function login(username: string, password: string): Promise<{ token: string }> {
+export async function login(username: string, password: string): Promise<TokenPair> {
   const res = await getHttpClient().post('/auth/login', { username, password })
   return res.data
 }
 
+// 用刷新令牌换取新的令牌对，旧刷新令牌随即失效。
+// 不经过getHttpClient的拦截器，避免刷新失败时再次触发刷新
+export async function refresh(refreshToken: string): Promise<TokenPair> {
+  const res = await axios.post<TokenPair>(`${BASE_URL}/auth/refresh`, { refreshToken }, { timeout: 20000 })
+  return res.data
+}
+
@@ -1,5 +1,5 @@
 import { defineStore } from 'pinia'
-import { login, register } from '@/services/auth'
+import { login, register, refresh } from '@/services/auth'
 
 export type UserProfile = {
   username: string
@@ -8,14 +8,32 @@ export type UserProfile = {
 export const useAuthStore = defineStore('auth', {
   state: () => ({
     token: '' as string,
+    refreshToken: '' as string,
     user: null as UserProfile | null,
   }),
   actions: {
     async performLogin(username: string, password: string) {
       const res = await login(username, password)
-      this.token = res.token
+      this.setTokens(res.token, res.refreshToken)
       this.user = { username }
-      window.localStorage.setItem('auth-token', this.token)
+    },
+    // 访问令牌过期后换取新令牌，刷新令牌无效时退出登录并抛出错误
+    async refreshSession(): Promise<string> {
+      if (!this.refreshToken) throw new Error('未登录')
+      try {
+        const res = await refresh(this.refreshToken)
+        this.setTokens(res.token, res.refreshToken)
+        return res.token
+      } catch (e) {
+        this.logout()
+        throw e
+      }
+    },
+    setTokens(token: string, refreshToken: string) {
+      this.token = token
+      this.refreshToken = refreshToken
+      window.localStorage.setItem('auth-token', token)
+      window.localStorage.setItem('auth-refresh-token', refreshToken)
     },
     async performRegister(username: string, password: string) {
       await register(username, password)
@@ -24,11 +42,15 @@ export const useAuthStore = defineStore('auth', {
     loadFromStorage() {
       const t = window.localStorage.getItem('auth-token')
       if (t) this.token = t
+      const rt = window.localStorage.getItem('auth-refresh-token')
+      if (rt) this.refreshToken = rt
     },
     logout() {
       this.token = ''
+      this.refreshToken = ''
       this.user = null
       window.localStorage.removeItem('auth-token')
+      window.localStorage.removeItem('auth-refresh-token')
     }
   }
 })